@@ -0,0 +1,158 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"google.golang.org/api/youtube/v3"
+)
+
+var account = flag.String("account", "", "Name of the Google account to use; each has its own login")
+
+var accountNameRe = regexp.MustCompile(`^[A-Za-z0-9_.-]+$`)
+
+// tokenCacheFile returns the token cache of the account. The unnamed
+// default account uses the cache file from before accounts existed.
+func tokenCacheFile(name string) string {
+	if name == "" {
+		return getHomeDir() + "/.yt-up.oauth.cache"
+	}
+	return getHomeDir() + "/.yt-up.oauth." + name + ".cache"
+}
+
+func accountsFile() string {
+	return getHomeDir() + "/.yt-up.accounts.json"
+}
+
+func checkAccountName(name string) error {
+	if name != "" && !accountNameRe.MatchString(name) {
+		return fmt.Errorf("Bad account name %q; use letters, digits, '.', '_' and '-'", name)
+	}
+	return nil
+}
+
+func accountLabel(name string) string {
+	if name == "" {
+		return "(default)"
+	}
+	return name
+}
+
+// loadChannelTitles returns the channel title last seen for each account.
+func loadChannelTitles() map[string]string {
+	titles := make(map[string]string)
+	if data, err := ioutil.ReadFile(accountsFile()); err == nil {
+		json.Unmarshal(data, &titles)
+	}
+	return titles
+}
+
+func saveChannelTitle(name string, title string) {
+	titles := loadChannelTitles()
+	if title == "" {
+		delete(titles, name)
+	} else {
+		titles[name] = title
+	}
+	if data, err := json.Marshal(titles); err == nil {
+		ioutil.WriteFile(accountsFile(), data, 0600)
+	}
+}
+
+// listAccounts returns the names of the accounts that have a token cache
+// file, or have been used with a token store that can't be listed.
+func listAccounts() ([]string, error) {
+	seen := make(map[string]bool)
+	for name := range loadChannelTitles() {
+		seen[name] = true
+	}
+	for _, suffix := range []string{".cache", ".cache.enc"} {
+		if _, err := os.Stat(getHomeDir() + "/.yt-up.oauth" + suffix); err == nil {
+			seen[""] = true
+		}
+		matches, err := filepath.Glob(getHomeDir() + "/.yt-up.oauth.*" + suffix)
+		if err != nil {
+			return nil, err
+		}
+		for _, m := range matches {
+			name := strings.TrimSuffix(strings.TrimPrefix(filepath.Base(m), ".yt-up.oauth."), suffix)
+			seen[name] = true
+		}
+	}
+	var names []string
+	for name := range seen {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// removeAccount deletes the account's token from every store, without
+// revoking it; see logout.
+func removeAccount(name string) error {
+	names, err := listAccounts()
+	if err != nil {
+		return err
+	}
+	i := sort.SearchStrings(names, name)
+	if i == len(names) || names[i] != name {
+		return fmt.Errorf("No account %s", accountLabel(name))
+	}
+	if err := deleteTokens(name); err != nil {
+		return err
+	}
+	saveChannelTitle(name, "")
+	return nil
+}
+
+// channelTitle returns the title of the channel the service is
+// authenticated as.
+func channelTitle(ctx context.Context, service *youtube.Service) (string, error) {
+	res, err := youtube.NewChannelsService(service).List("snippet").Mine(true).Context(ctx).Do()
+	if err != nil {
+		return "", fmt.Errorf("Error getting channel: %w", err)
+	}
+	if len(res.Items) == 0 {
+		return "", fmt.Errorf("The account has no YouTube channel")
+	}
+	return res.Items[0].Snippet.Title, nil
+}
+
+func accountsCommand(args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("Usage: yt-up accounts list|remove NAME")
+	}
+	switch args[0] {
+	case "list":
+		names, err := listAccounts()
+		if err != nil {
+			return err
+		}
+		titles := loadChannelTitles()
+		for _, name := range names {
+			fmt.Printf("%-20s %s\n", accountLabel(name), titles[name])
+		}
+		return nil
+	case "remove":
+		if len(args) != 2 {
+			return fmt.Errorf("Usage: yt-up accounts remove NAME")
+		}
+		name := args[1]
+		if name == "default" {
+			name = ""
+		}
+		if err := checkAccountName(name); err != nil {
+			return err
+		}
+		return removeAccount(name)
+	}
+	return fmt.Errorf("Unknown accounts command %q", args[0])
+}
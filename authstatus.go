@@ -0,0 +1,194 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/omakoto/yt-up/oauth"
+)
+
+// UPLOAD_SCOPE is the scope uploads need; DEVICE_SCOPE includes it.
+const UPLOAD_SCOPE = "https://www.googleapis.com/auth/youtube.upload"
+
+// decodeIDToken returns the claims of an id_token. The signature isn't
+// checked; the claims are only shown.
+func decodeIDToken(idToken string) (map[string]interface{}, error) {
+	parts := strings.Split(idToken, ".")
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("Malformed id_token")
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(parts[1], "="))
+	if err != nil {
+		return nil, fmt.Errorf("Malformed id_token: %v", err)
+	}
+	claims := make(map[string]interface{})
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		return nil, fmt.Errorf("Malformed id_token: %v", err)
+	}
+	return claims, nil
+}
+
+// tokenInfo asks Google what it knows about an access token.
+func tokenInfo(ctx context.Context, accessToken string) (map[string]interface{}, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", TOKENINFO_URL+"?"+url.Values{"access_token": {accessToken}}.Encode(), nil)
+	if err != nil {
+		return nil, err
+	}
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	body, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return nil, err
+	}
+	if res.StatusCode != http.StatusOK {
+		return nil, oauth.ParseError(res, body)
+	}
+	info := make(map[string]interface{})
+	if err := json.Unmarshal(body, &info); err != nil {
+		return nil, err
+	}
+	return info, nil
+}
+
+func printStatus(key string, format string, args ...interface{}) {
+	fmt.Printf("%-16s %s\n", key, fmt.Sprintf(format, args...))
+}
+
+func printClaims(claims map[string]interface{}) {
+	var keys []string
+	for k := range claims {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		v := claims[k]
+		// Timestamps are more useful as dates.
+		if n, ok := v.(float64); ok && (k == "exp" || k == "iat" || k == "auth_time") {
+			v = time.Unix(int64(n), 0).Format(time.RFC3339)
+		}
+		printStatus("  "+k, "%v", v)
+	}
+}
+
+func hasScope(scopes string, scope string) bool {
+	for _, s := range strings.Fields(scopes) {
+		if s == scope || s == DEVICE_SCOPE {
+			return true
+		}
+	}
+	return false
+}
+
+// authStatus prints what the account's cached token is good for. With
+// refresh, the refresh token is used even if the access token is valid.
+func authStatus(ctx context.Context, refresh bool) error {
+	cache := tokenCache()
+	tok, err := cache.Token()
+	if oauth.IsNotFound(err) {
+		return fmt.Errorf("Account %s is not logged in", accountLabel(*account))
+	} else if err != nil {
+		return fmt.Errorf("Cannot read token cache: %v", err)
+	}
+
+	printStatus("account", "%s", accountLabel(*account))
+	printStatus("token store", "%s", *tokenStore)
+
+	if refresh {
+		if tok.RefreshToken == "" {
+			return fmt.Errorf("The token has no refresh token; run yt-up logout and authorize again")
+		}
+		config, err := buildConfig(SCOPE)
+		if err != nil {
+			return err
+		}
+		// Refreshing tok as if it had been rejected goes through the
+		// cache's lock and saves the new token, as uploads do.
+		ts := oauth.TokenSource(ctx, config, cache, tok, *expirySkew)
+		fresh, err := ts.(oauth.Refresher).Refresh(ctx, tok)
+		if err != nil {
+			printStatus("refresh", "FAILED: %v", err)
+			if oauth.IsCode(err, "invalid_grant") {
+				return fmt.Errorf("The refresh token has been revoked or has expired; run yt-up logout and authorize again")
+			}
+			return explainAuthError(err)
+		}
+		tok = fresh
+		printStatus("refresh", "ok")
+	}
+
+	if tok.Expiry.IsZero() {
+		printStatus("access token", "no expiry")
+	} else if tok.Valid() {
+		printStatus("access token", "valid until %s (%s left)", tok.Expiry.Format(time.RFC3339), time.Until(tok.Expiry).Round(time.Second))
+	} else {
+		printStatus("access token", "expired at %s", tok.Expiry.Format(time.RFC3339))
+	}
+	if tok.RefreshToken != "" {
+		printStatus("refresh token", "present")
+	} else {
+		printStatus("refresh token", "MISSING; the access token can't be renewed")
+	}
+
+	scopes, _ := tok.Extra("scope").(string)
+	if scopes == "" {
+		printStatus("scopes", "not recorded in the cache")
+	} else {
+		printStatus("scopes", "%s", scopes)
+	}
+
+	if idToken, ok := tok.Extra("id_token").(string); ok && idToken != "" {
+		claims, err := decodeIDToken(idToken)
+		if err != nil {
+			printStatus("id_token", "%v", err)
+		} else {
+			printStatus("id_token", "")
+			printClaims(claims)
+		}
+	} else {
+		printStatus("id_token", "none")
+	}
+
+	if tok.Valid() {
+		info, err := tokenInfo(ctx, tok.AccessToken)
+		if err != nil {
+			printStatus("tokeninfo", "FAILED: %v", err)
+		} else {
+			printStatus("tokeninfo", "")
+			printClaims(info)
+			if s, ok := info["scope"].(string); ok {
+				scopes = s
+			}
+		}
+	} else {
+		printStatus("tokeninfo", "skipped, the access token has expired; use -refresh")
+	}
+
+	if scopes != "" && !hasScope(scopes, UPLOAD_SCOPE) {
+		return fmt.Errorf("The token isn't allowed to upload videos; run yt-up logout and authorize again")
+	}
+	return nil
+}
+
+func authStatusCommand(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("auth status", flag.ContinueOnError)
+	refresh := fs.Bool("refresh", false, "Refresh the access token to check that the refresh token works")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 0 {
+		return fmt.Errorf("Usage: yt-up auth status [-refresh]")
+	}
+	return authStatus(ctx, *refresh)
+}
@@ -0,0 +1,226 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"google.golang.org/api/youtube/v3"
+)
+
+// captionTrack is a caption file to upload with the video.
+type captionTrack struct {
+	Language string
+	Path     string
+	Name     string
+}
+
+// captionFlags implements flag.Value for the repeatable -caption flag.
+type captionFlags []*captionTrack
+
+var captions captionFlags
+
+func init() {
+	flag.Var(&captions, "caption", "Caption track to upload as lang:path[:name] (.srt or .vtt); can be repeated")
+}
+
+func (c *captionFlags) String() string {
+	var s []string
+	for _, t := range *c {
+		s = append(s, t.Language+":"+t.Path)
+	}
+	return strings.Join(s, ",")
+}
+
+func (c *captionFlags) Set(value string) error {
+	fields := strings.SplitN(value, ":", 3)
+	if len(fields) < 2 || fields[0] == "" || fields[1] == "" {
+		return fmt.Errorf("expected lang:path[:name], got %q", value)
+	}
+	t := &captionTrack{Language: fields[0], Path: fields[1]}
+	if len(fields) == 3 {
+		t.Name = fields[2]
+	}
+	*c = append(*c, t)
+	return nil
+}
+
+var (
+	srtTimingRe = regexp.MustCompile(`^(\d+):(\d{2}):(\d{2}),(\d{3}) --> (\d+):(\d{2}):(\d{2}),(\d{3})$`)
+	vttTimingRe = regexp.MustCompile(`^(?:(\d+):)?(\d{2}):(\d{2})\.(\d{3}) --> (?:(\d+):)?(\d{2}):(\d{2})\.(\d{3})(?:\s.*)?$`)
+)
+
+// validateCaptions checks the syntax of an SRT or WebVTT file: every cue
+// has a well formed timing line that ends after it starts, cues start in
+// order, and no cue id is used twice.
+func validateCaptions(path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	var timingRe *regexp.Regexp
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".srt":
+		timingRe = srtTimingRe
+	case ".vtt":
+		timingRe = vttTimingRe
+	default:
+		return fmt.Errorf("%s: unknown caption format; use .srt or .vtt", path)
+	}
+	if err := checkCues(file, timingRe, timingRe == vttTimingRe); err != nil {
+		return fmt.Errorf("%s: %v", path, err)
+	}
+	return nil
+}
+
+func checkCues(r io.Reader, timingRe *regexp.Regexp, vtt bool) error {
+	scanner := bufio.NewScanner(r)
+	lineNo := 0
+	var block []string
+	var blockLine int
+	ids := make(map[string]int)
+	var lastStart time.Duration
+	cues := 0
+	headerSeen := false
+
+	checkBlock := func() error {
+		if len(block) == 0 {
+			return nil
+		}
+		defer func() { block = nil }()
+
+		if vtt {
+			if !headerSeen {
+				headerSeen = true
+				if !strings.HasPrefix(block[0], "WEBVTT") {
+					return fmt.Errorf("line %d: missing WEBVTT header", blockLine)
+				}
+				return nil
+			}
+			if strings.HasPrefix(block[0], "NOTE") || block[0] == "STYLE" || block[0] == "REGION" {
+				return nil
+			}
+		}
+
+		id := ""
+		timing := 0
+		if !strings.Contains(block[0], "-->") {
+			id = block[0]
+			timing = 1
+		}
+		if timing >= len(block) {
+			return fmt.Errorf("line %d: cue has no timing line", blockLine)
+		}
+		if !vtt {
+			if _, err := strconv.Atoi(id); err != nil {
+				return fmt.Errorf("line %d: expected numeric cue id, got %q", blockLine, id)
+			}
+		}
+		if id != "" {
+			if prev, ok := ids[id]; ok {
+				return fmt.Errorf("line %d: cue id %q already used on line %d", blockLine, id, prev)
+			}
+			ids[id] = blockLine
+		}
+
+		m := timingRe.FindStringSubmatch(block[timing])
+		if m == nil {
+			return fmt.Errorf("line %d: bad timing line %q", blockLine+timing, block[timing])
+		}
+		start, end := cueTime(m[1:5]), cueTime(m[5:9])
+		if end <= start {
+			return fmt.Errorf("line %d: cue ends before it starts", blockLine+timing)
+		}
+		if start < lastStart {
+			return fmt.Errorf("line %d: cue starts before the previous cue", blockLine+timing)
+		}
+		lastStart = start
+		cues++
+		return nil
+	}
+
+	for scanner.Scan() {
+		lineNo++
+		line := strings.TrimRight(scanner.Text(), "\r")
+		if lineNo == 1 {
+			line = strings.TrimPrefix(line, "\ufeff")
+		}
+		if strings.TrimSpace(line) == "" {
+			if err := checkBlock(); err != nil {
+				return err
+			}
+			continue
+		}
+		if len(block) == 0 {
+			blockLine = lineNo
+		}
+		block = append(block, line)
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	if err := checkBlock(); err != nil {
+		return err
+	}
+	if cues == 0 {
+		return fmt.Errorf("no cues found")
+	}
+	return nil
+}
+
+// cueTime converts hours, minutes, seconds and milliseconds to a duration.
+// The hours may be empty in WebVTT.
+func cueTime(fields []string) time.Duration {
+	var d time.Duration
+	units := []time.Duration{time.Hour, time.Minute, time.Second, time.Millisecond}
+	for i, f := range fields {
+		n, _ := strconv.Atoi(f)
+		d += time.Duration(n) * units[i]
+	}
+	return d
+}
+
+func insertCaption(ctx context.Context, service *youtube.Service, videoId string, track *captionTrack) error {
+	file, err := os.Open(track.Path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	_, err = youtube.NewCaptionsService(service).Insert("snippet", &youtube.Caption{
+		Snippet: &youtube.CaptionSnippet{
+			VideoId:  videoId,
+			Language: track.Language,
+			Name:     track.Name,
+		},
+	}).Media(file).Context(ctx).Do()
+	if err != nil {
+		return fmt.Errorf("Error inserting caption %s: %w", track.Path, err)
+	}
+	return nil
+}
+
+// hasCaption reports whether the video already has a track in the track's
+// language with the same name.
+func hasCaption(ctx context.Context, service *youtube.Service, videoId string, track *captionTrack) (bool, error) {
+	result, err := youtube.NewCaptionsService(service).List("snippet", videoId).Context(ctx).Do()
+	if err != nil {
+		return false, fmt.Errorf("Error listing captions: %w", err)
+	}
+	for _, c := range result.Items {
+		if c.Snippet != nil && c.Snippet.Language == track.Language && c.Snippet.Name == track.Name {
+			return true, nil
+		}
+	}
+	return false, nil
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"google.golang.org/api/youtube/v3"
+)
+
+var (
+	region         = flag.String("region", "US", "Region code used to look up video categories by name")
+	listCategories = flag.Bool("list-categories", false, "List video categories for -region and exit")
+)
+
+// CATEGORY_CACHE_AGE is how long a fetched category table is used before
+// it's fetched again; categories rarely change.
+const CATEGORY_CACHE_AGE = 30 * 24 * time.Hour
+
+type videoCategory struct {
+	Id         string
+	Title      string
+	Assignable bool
+}
+
+type categoryCache struct {
+	Fetched    time.Time
+	Categories []videoCategory
+}
+
+func categoryCacheFile(region string) string {
+	return getHomeDir() + "/.yt-up.categories." + strings.ToUpper(region) + ".json"
+}
+
+func fetchCategories(ctx context.Context, service *youtube.Service, region string) ([]videoCategory, error) {
+	res, err := youtube.NewVideoCategoriesService(service).List("snippet").RegionCode(region).Context(ctx).Do()
+	if err != nil {
+		return nil, fmt.Errorf("Error listing video categories: %w", err)
+	}
+	var categories []videoCategory
+	for _, item := range res.Items {
+		categories = append(categories, videoCategory{
+			Id:         item.Id,
+			Title:      item.Snippet.Title,
+			Assignable: item.Snippet.Assignable,
+		})
+	}
+	sort.Slice(categories, func(i, j int) bool {
+		a, _ := strconv.Atoi(categories[i].Id)
+		b, _ := strconv.Atoi(categories[j].Id)
+		return a < b
+	})
+	return categories, nil
+}
+
+// loadCategories returns the categories for the region, from the cache
+// file if it's fresh enough.
+func loadCategories(ctx context.Context, service *youtube.Service, retry *retryPolicy, region string) ([]videoCategory, error) {
+	cache := &categoryCache{}
+	if data, err := ioutil.ReadFile(categoryCacheFile(region)); err == nil {
+		if json.Unmarshal(data, cache) == nil && time.Since(cache.Fetched) < CATEGORY_CACHE_AGE {
+			return cache.Categories, nil
+		}
+	}
+
+	var categories []videoCategory
+	err := retry.do(ctx, "Listing video categories", func() (err error) {
+		categories, err = fetchCategories(ctx, service, region)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	cache = &categoryCache{Fetched: time.Now(), Categories: categories}
+	if data, err := json.Marshal(cache); err == nil {
+		ioutil.WriteFile(categoryCacheFile(region), data, 0600)
+	}
+	return categories, nil
+}
+
+func isCategoryId(s string) bool {
+	_, err := strconv.Atoi(s)
+	return err == nil
+}
+
+// resolveCategory returns the ID of the category with the given name,
+// ignoring case. An unknown name is reported with similar names, if any.
+func resolveCategory(categories []videoCategory, name string) (string, error) {
+	var suggestions []string
+	lower := strings.ToLower(strings.TrimSpace(name))
+	for _, c := range categories {
+		title := strings.ToLower(c.Title)
+		if title == lower {
+			if !c.Assignable {
+				return "", fmt.Errorf("Category %q can't be assigned to videos", c.Title)
+			}
+			return c.Id, nil
+		}
+		if c.Assignable && (strings.Contains(title, lower) || strings.Contains(lower, title) || editDistance(title, lower) <= 3) {
+			suggestions = append(suggestions, fmt.Sprintf("%q", c.Title))
+		}
+	}
+	if len(suggestions) > 0 {
+		return "", fmt.Errorf("Unknown category %q; did you mean %s?", name, strings.Join(suggestions, " or "))
+	}
+	return "", fmt.Errorf("Unknown category %q; see -list-categories", name)
+}
+
+// editDistance returns the Levenshtein distance between a and b.
+func editDistance(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+	prev := make([]int, len(rb)+1)
+	cur := make([]int, len(rb)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(ra); i++ {
+		cur[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(rb)]
+}
+
+func printCategories(categories []videoCategory) {
+	for _, c := range categories {
+		note := ""
+		if !c.Assignable {
+			note = " (not assignable)"
+		}
+		fmt.Printf("%4s  %s%s\n", c.Id, c.Title, note)
+	}
+}
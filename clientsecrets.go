@@ -0,0 +1,79 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"strings"
+)
+
+// clientSecretsInfo is one of the layouts of the client_secret.json file that
+// the Google Cloud console gives out.
+type clientSecretsInfo struct {
+	ClientId     string   `json:"client_id"`
+	ClientSecret string   `json:"client_secret"`
+	AuthURI      string   `json:"auth_uri"`
+	TokenURI     string   `json:"token_uri"`
+	RedirectURIs []string `json:"redirect_uris"`
+
+	// web is true for a "web" client, which must use one of RedirectURIs
+	// as is, instead of any loopback port.
+	web bool
+}
+
+// readClientSecrets reads a client_secret.json file, in either the
+// "installed" or the "web" layout.
+func readClientSecrets(path string) (*clientSecretsInfo, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var file struct {
+		Installed *clientSecretsInfo `json:"installed"`
+		Web       *clientSecretsInfo `json:"web"`
+	}
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("Error parsing %s: %v", path, err)
+	}
+
+	var info *clientSecretsInfo
+	var layout string
+	switch {
+	case file.Installed != nil:
+		info, layout = file.Installed, "installed"
+	case file.Web != nil:
+		info, layout = file.Web, "web"
+		info.web = true
+	default:
+		return nil, fmt.Errorf("%s has neither an \"installed\" nor a \"web\" client", path)
+	}
+
+	var missing []string
+	check := func(field, value string) {
+		if value == "" {
+			missing = append(missing, layout+"."+field)
+		}
+	}
+	check("client_id", info.ClientId)
+	check("client_secret", info.ClientSecret)
+	check("auth_uri", info.AuthURI)
+	check("token_uri", info.TokenURI)
+	if info.web && len(info.RedirectURIs) == 0 {
+		missing = append(missing, layout+".redirect_uris")
+	}
+	if len(missing) > 0 {
+		return nil, fmt.Errorf("%s is missing %s", path, strings.Join(missing, ", "))
+	}
+	return info, nil
+}
+
+// loopbackRedirectURI returns the first redirect URI that this program
+// can listen on.
+func (info *clientSecretsInfo) loopbackRedirectURI() (string, error) {
+	for _, uri := range info.RedirectURIs {
+		if isLoopbackURL(uri) {
+			return uri, nil
+		}
+	}
+	return "", fmt.Errorf("None of the client's redirect URIs is an http://localhost, 127.0.0.1 or [::1] address; add one in the Google Cloud console")
+}
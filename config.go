@@ -0,0 +1,167 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+)
+
+var (
+	configFile        = flag.String("config", "", "Config file (default $XDG_CONFIG_HOME/yt-up/config.toml)")
+	profile           = flag.String("profile", "", "Named profile from the config file")
+	showConfig        = flag.Bool("show-config", false, "Print the effective settings and where each came from, and exit")
+	descriptionFooter = flag.String("description-footer", "", "Text appended to every video description")
+	clientSecrets     = flag.String("client-secrets", "", "client_secret.json file of the OAuth client, from the Google Cloud console")
+)
+
+// profileConfig holds the settings that can be given in the config file,
+// either at the top level or in a [profile.NAME] table.
+type profileConfig struct {
+	Privacy           string   `toml:"privacy"`
+	Playlist          string   `toml:"playlist"`
+	Category          string   `toml:"category"`
+	Tags              []string `toml:"tags"`
+	DescriptionFooter string   `toml:"description_footer"`
+	ClientSecrets     string   `toml:"client_secrets"`
+	Account           string   `toml:"account"`
+	AuthMode          string   `toml:"auth_mode"`
+	TokenStore        string   `toml:"token_store"`
+	ServiceAccount    string   `toml:"service_account"`
+	Impersonate       string   `toml:"impersonate"`
+}
+
+type config struct {
+	profileConfig
+	Profiles map[string]profileConfig `toml:"profile"`
+}
+
+// setting is a value that can come from a flag, an environment variable,
+// the config file or the flag default, in that order of precedence.
+type setting struct {
+	flag   string
+	env    string
+	value  *string
+	config func(p *profileConfig) string
+	source string
+}
+
+var settings = []*setting{
+	{flag: "privacy", env: "YT_UP_PRIVACY", value: privacy,
+		config: func(p *profileConfig) string { return p.Privacy }},
+	{flag: "playlist", env: "YT_UP_PLAYLIST", value: playlist,
+		config: func(p *profileConfig) string { return p.Playlist }},
+	{flag: "category", env: "YT_UP_CATEGORY", value: category,
+		config: func(p *profileConfig) string { return p.Category }},
+	{flag: "keywords", env: "YT_UP_KEYWORDS", value: keywords,
+		config: func(p *profileConfig) string { return strings.Join(p.Tags, ",") }},
+	{flag: "description-footer", env: "YT_UP_DESCRIPTION_FOOTER", value: descriptionFooter,
+		config: func(p *profileConfig) string { return p.DescriptionFooter }},
+	{flag: "client-secrets", env: "YT_UP_CLIENT_SECRETS", value: clientSecrets,
+		config: func(p *profileConfig) string { return p.ClientSecrets }},
+	{flag: "account", env: "YT_UP_ACCOUNT", value: account,
+		config: func(p *profileConfig) string { return p.Account }},
+	{flag: "auth-mode", env: "YT_UP_AUTH_MODE", value: authMode,
+		config: func(p *profileConfig) string { return p.AuthMode }},
+	{flag: "token-store", env: "YT_UP_TOKEN_STORE", value: tokenStore,
+		config: func(p *profileConfig) string { return p.TokenStore }},
+	{flag: "service-account", env: "YT_UP_SERVICE_ACCOUNT", value: serviceAccount,
+		config: func(p *profileConfig) string { return p.ServiceAccount }},
+	{flag: "impersonate", env: "YT_UP_IMPERSONATE", value: impersonate,
+		config: func(p *profileConfig) string { return p.Impersonate }},
+}
+
+func configFilePath() string {
+	if *configFile != "" {
+		return *configFile
+	}
+	dir := os.Getenv("XDG_CONFIG_HOME")
+	if dir == "" {
+		dir = getHomeDir() + "/.config"
+	}
+	return filepath.Join(dir, "yt-up", "config.toml")
+}
+
+// readConfig reads the config file. A missing file is the same as an empty
+// one unless it was given with -config.
+func readConfig(path string) (*config, error) {
+	c := &config{}
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) && *configFile == "" {
+		return c, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if _, err := toml.Decode(string(data), c); err != nil {
+		return nil, fmt.Errorf("Error parsing %s: %v", path, err)
+	}
+	return c, nil
+}
+
+// loadConfig merges the config file, environment variables and flags into
+// the flag variables.
+func loadConfig() error {
+	path := configFilePath()
+	c, err := readConfig(path)
+	if err != nil {
+		return err
+	}
+
+	var p *profileConfig
+	if *profile != "" {
+		prof, ok := c.Profiles[*profile]
+		if !ok {
+			return fmt.Errorf("No profile %q in %s", *profile, path)
+		}
+		p = &prof
+	}
+
+	set := make(map[string]bool)
+	flag.Visit(func(f *flag.Flag) {
+		set[f.Name] = true
+	})
+
+	for _, s := range settings {
+		if set[s.flag] {
+			s.source = "-" + s.flag
+			continue
+		}
+		s.source = "default"
+		if v := s.config(&c.profileConfig); v != "" {
+			*s.value, s.source = v, path
+		}
+		if p != nil {
+			if v := s.config(p); v != "" {
+				*s.value, s.source = v, path+" [profile."+*profile+"]"
+			}
+		}
+		if v := os.Getenv(s.env); v != "" {
+			*s.value, s.source = v, "$"+s.env
+		}
+	}
+	return nil
+}
+
+func settingSource(flagName string) string {
+	for _, s := range settings {
+		if s.flag == flagName {
+			return s.source
+		}
+	}
+	return ""
+}
+
+func printConfig() {
+	fmt.Printf("config file: %s\n", configFilePath())
+	if *profile != "" {
+		fmt.Printf("profile: %s\n", *profile)
+	}
+	for _, s := range settings {
+		fmt.Printf("%-20s %-30q (%s)\n", s.flag, *s.value, s.source)
+	}
+}
@@ -1,30 +1,36 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"fmt"
 	"log"
+	"net/http"
 	"os"
+	"os/signal"
 	"strings"
 	"syscall"
 	"time"
 
 	"golang.org/x/crypto/ssh/terminal"
-	"golang.org/x/net/context"
 
 	"google.golang.org/api/youtube/v3"
 	"github.com/omakoto/bashcomp"
 	"github.com/omakoto/mlib"
+	"github.com/omakoto/yt-up/oauth"
 )
 
 var (
-	filename    = flag.String("filename", "", "Name of video file to upload")
+	filename    = flag.String("filename", "", "Name of video file to upload, or - for stdin")
 	title       = flag.String("title", "", "Video title")
 	description = flag.String("description", "", "Video description")
-	category    = flag.String("category", "", "Video category") // TODO
+	category    = flag.String("category", "", "Video category ID or name, e.g. 28 or \"Science & Technology\"")
 	keywords    = flag.String("keywords", "", "Comma separated list of video keywords")
 	privacy     = flag.String("privacy", "unlisted", "Video privacy status (private|unlisted|public)")
 	playlist    = flag.String("playlist", "", "Playlist name to add video to")
+	resume      = flag.Bool("resume", false, "Resume the interrupted upload of -filename, or the only one; with -manifest, skip the files already uploaded and retry the thumbnail, playlist and captions that failed")
+	manifest    = flag.String("manifest", "", "YAML, JSON or CSV file listing videos to upload")
+	thumbnail   = flag.String("thumbnail", "", "JPEG or PNG file to set as the video thumbnail")
 	lastPercent = (int64)(0)
 )
 
@@ -33,6 +39,9 @@ const (
 )
 
 func progress(current, total int64) {
+	if total <= 0 {
+		return
+	}
 	newPercent := current * 100 / total
 	if newPercent > lastPercent {
 		msg := fmt.Sprintf("Uploading... (%d KB / %d KB uploaded, %d%%)", current/1024, total/1024, newPercent)
@@ -45,25 +54,25 @@ func progress(current, total int64) {
 	lastPercent = newPercent
 }
 
-func findPlaylist(service *youtube.Service, title string) string {
+func findPlaylist(ctx context.Context, service *youtube.Service, title string) (string, error) {
 	playlists := youtube.NewPlaylistsService(service)
 	playListsCall := playlists.List("snippet")
 	playListsCall.Mine(true)
-	playlistsResult, err := playListsCall.Do()
+	playlistsResult, err := playListsCall.Context(ctx).Do()
 	if err != nil {
-		log.Fatalf("Error listing playlists: %v", err)
+		return "", fmt.Errorf("Error listing playlists: %w", err)
 	}
 
 	for _, item := range playlistsResult.Items {
 		mlib.DebugDump(item)
 		if item.Snippet.Title == title {
-			return item.Id
+			return item.Id, nil
 		}
 	}
-	return ""
+	return "", nil
 }
 
-func createPlaylist(service *youtube.Service, title string) string {
+func createPlaylist(ctx context.Context, service *youtube.Service, title string, privacy string) (string, error) {
 	playlists := youtube.NewPlaylistsService(service)
 
 	playlist := youtube.Playlist{
@@ -71,21 +80,21 @@ func createPlaylist(service *youtube.Service, title string) string {
 			Title: title,
 		},
 		Status: &youtube.PlaylistStatus{
-			PrivacyStatus: *privacy,
+			PrivacyStatus: privacy,
 		},
 	}
 
 	playListsCall := playlists.Insert("snippet,status", &playlist)
-	playlistsResult, err := playListsCall.Do()
+	playlistsResult, err := playListsCall.Context(ctx).Do()
 	if err != nil {
-		log.Fatalf("Error inserting playlist: %v", err)
+		return "", fmt.Errorf("Error inserting playlist: %w", err)
 	}
 	mlib.DebugDump(playlistsResult)
 
-	return playlistsResult.Id
+	return playlistsResult.Id, nil
 }
 
-func addToPlaylist(service *youtube.Service, videoId string, playlistId string) {
+func addToPlaylist(ctx context.Context, service *youtube.Service, videoId string, playlistId string) error {
 	items := youtube.NewPlaylistItemsService(service)
 
 	itemInsertCall := items.Insert("snippet", &youtube.PlaylistItem{
@@ -97,93 +106,589 @@ func addToPlaylist(service *youtube.Service, videoId string, playlistId string)
 			},
 		},
 	})
-	_, err := itemInsertCall.Do()
+	_, err := itemInsertCall.Context(ctx).Do()
 	if err != nil {
-		log.Fatalf("Error adding video to playlist: %v", err)
+		return fmt.Errorf("Error adding video to playlist: %w", err)
 	}
+	return nil
 }
 
-func main() {
-	flag.Parse()
-
-	bashcomp.HandleBashCompletion()
+// playlistHasVideo reports whether the video is already in the playlist.
+func playlistHasVideo(ctx context.Context, service *youtube.Service, playlistId string, videoId string) (bool, error) {
+	items := youtube.NewPlaylistItemsService(service)
 
-	if *filename == "" {
-		log.Fatalf("Specify a filename of a video file with -filename")
+	result, err := items.List("id").PlaylistId(playlistId).VideoId(videoId).Context(ctx).Do()
+	if err != nil {
+		return false, fmt.Errorf("Error listing playlist items: %w", err)
 	}
+	return len(result.Items) > 0, nil
+}
 
-	log.Printf("Requesting auth token...\n")
+// uploader uploads videos with a single authenticated client, remembering
+// playlists it has already looked up.
+type uploader struct {
+	client    *http.Client
+	service   *youtube.Service
+	retry     *retryPolicy
+	playlists map[string]string // Title to ID.
+}
 
-	client, err := buildOAuthHTTPClient(SCOPE)
-	if err != nil {
-		log.Fatalf("Error building OAuth client: %v", err)
+func newUploader(client *http.Client, service *youtube.Service, retry *retryPolicy) *uploader {
+	return &uploader{
+		client:    client,
+		service:   service,
+		retry:     retry,
+		playlists: make(map[string]string),
 	}
+}
 
-	log.Printf("Uploading %s...\n", *filename)
-
-	service, err := youtube.New(client)
+func (u *uploader) playlistId(ctx context.Context, title string, privacy string) (string, error) {
+	if id, ok := u.playlists[title]; ok {
+		return id, nil
+	}
+	var playlistId string
+	err := u.retry.do(ctx, "Listing playlists", func() (err error) {
+		playlistId, err = findPlaylist(ctx, u.service, title)
+		return err
+	})
 	if err != nil {
-		log.Fatalf("Error creating YouTube client: %v", err)
+		return "", err
+	}
+	if playlistId != "" {
+		log.Printf("Playlist found: %s\n", playlistId)
+	} else {
+		exists := func() (found bool, err error) {
+			playlistId, err = findPlaylist(ctx, u.service, title)
+			return playlistId != "", err
+		}
+		err = u.retry.doInsert(ctx, "Creating playlist", false, exists, func() (err error) {
+			playlistId, err = createPlaylist(ctx, u.service, title, privacy)
+			return err
+		})
+		if err != nil {
+			return "", err
+		}
+		log.Printf("Playlist created: id=%s", playlistId)
+	}
+	u.playlists[title] = playlistId
+	return playlistId, nil
+}
+
+// upload uploads the video described by entry. If state is non-nil, it
+// continues the interrupted upload session instead of starting a new one.
+// Along with the video, it returns the result of each caption track, e.g.
+// "en ok". The video is returned if it was uploaded, even if a later step
+// failed.
+func (u *uploader) upload(ctx context.Context, entry *manifestEntry, state *uploadState) (*youtube.Video, []string, error) {
+	log.Printf("Uploading %s...\n", entry.File)
+
+	description := entry.Description
+	if *descriptionFooter != "" {
+		if description != "" {
+			description += "\n\n"
+		}
+		description += *descriptionFooter
 	}
 
 	upload := &youtube.Video{
 		Snippet: &youtube.VideoSnippet{
-			Title:       *title,
-			Description: *description,
-			CategoryId:  *category,
+			Title:       entry.Title,
+			Description: description,
+			CategoryId:  entry.Category,
+			Tags:        entry.Tags,
 		},
-		Status: &youtube.VideoStatus{PrivacyStatus: *privacy},
+		Status: &youtube.VideoStatus{PrivacyStatus: entry.Privacy},
 	}
 
-	// The API returns a 400 Bad Request response if tags is an empty string.
-	if strings.Trim(*keywords, "") != "" {
-		upload.Snippet.Tags = strings.Split(*keywords, ",")
+	// Scheduled videos must be private until they're published.
+	if !entry.PublishAt.IsZero() {
+		if entry.Privacy != "private" {
+			log.Printf("Uploading as private to publish at %s\n", formatPublishTime(entry.PublishAt))
+		}
+		upload.Status.PrivacyStatus = "private"
+		upload.Status.PublishAt = entry.PublishAt.UTC().Format(time.RFC3339)
 	}
 
-	call := service.Videos.Insert("snippet,status", upload)
+	var response *youtube.Video
+	var sent int64
+	var err error
+	start := time.Now()
+	if isStream(entry.File) {
+		response, sent, err = u.uploadStream(ctx, entry, upload)
+	} else {
+		response, sent, err = u.uploadFile(ctx, entry, upload, state)
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	duration := time.Since(start)
 
-	call.ProgressUpdater(progress)
+	oneHundreadMegMinutes := 0.0
+	if sent > 0 {
+		oneHundreadMegMinutes = float64(duration.Minutes() * 100.0 * 1024.0 * 1024.0 / float64(sent))
+	}
+	if terminal.IsTerminal(syscall.Stdout) {
+		fmt.Printf("\n")
+	}
 
-	file, err := os.Open(*filename)
-	defer file.Close()
+	log.Printf("Uploaded %.1f MB in %s, %.1f minutes for 100MB : http://youtube.com/watch?v=%v\n", float64(sent)/(1024.0*1024.0), duration, oneHundreadMegMinutes, response.Id)
+
+	report, err := u.finish(ctx, entry, response.Id, false)
+	if err != nil {
+		return response, report, err
+	}
+
+	if !entry.PublishAt.IsZero() {
+		log.Printf("Scheduled to publish at %s\n", formatPublishTime(entry.PublishAt))
+	}
+	return response, report, nil
+}
+
+// finish sets the thumbnail, playlist and captions of the uploaded video,
+// trying each even if another fails. resumed means an earlier run may have
+// done some of them. It returns the result of each caption track, e.g.
+// "en ok".
+func (u *uploader) finish(ctx context.Context, entry *manifestEntry, videoId string, resumed bool) ([]string, error) {
+	var failures []string
+	if entry.Thumbnail != "" {
+		err := u.retry.do(ctx, "Setting thumbnail", func() error {
+			return setThumbnail(ctx, u.service, videoId, entry.Thumbnail)
+		})
+		if err != nil {
+			failures = append(failures, err.Error())
+		} else {
+			log.Printf("Thumbnail set")
+		}
+	}
+
+	if entry.Playlist != "" {
+		playlistId, err := u.playlistId(ctx, entry.Playlist, entry.Privacy)
+		if err == nil {
+			exists := func() (bool, error) {
+				return playlistHasVideo(ctx, u.service, playlistId, videoId)
+			}
+			err = u.retry.doInsert(ctx, "Adding to playlist", resumed, exists, func() error {
+				return addToPlaylist(ctx, u.service, videoId, playlistId)
+			})
+		}
+		if err != nil {
+			failures = append(failures, err.Error())
+		} else {
+			log.Printf("Video added to playlist")
+		}
+	}
+
+	var report []string
+	if len(entry.Captions) > 0 {
+		for _, t := range entry.Captions {
+			exists := func() (bool, error) {
+				return hasCaption(ctx, u.service, videoId, t)
+			}
+			err := u.retry.doInsert(ctx, "Inserting caption", resumed, exists, func() error {
+				return insertCaption(ctx, u.service, videoId, t)
+			})
+			if err != nil {
+				failures = append(failures, err.Error())
+				report = append(report, t.Language+" FAILED")
+			} else {
+				report = append(report, t.Language+" ok")
+			}
+		}
+		log.Printf("Captions: %s\n", strings.Join(report, ", "))
+	}
+
+	if len(failures) > 0 {
+		return report, fmt.Errorf("Uploaded http://youtube.com/watch?v=%v, but: %s", videoId, strings.Join(failures, "; "))
+	}
+	if !isStream(entry.File) {
+		markUploadFinished(entry.File)
+	}
+	return report, nil
+}
+
+// uploadFile sends the media of a video from a regular file, continuing the
+// interrupted session in state if it's non-nil. It returns the video and
+// the number of bytes sent.
+func (u *uploader) uploadFile(ctx context.Context, entry *manifestEntry, upload *youtube.Video, state *uploadState) (*youtube.Video, int64, error) {
+	file, err := os.Open(entry.File)
 	if err != nil {
-		log.Fatalf("Error opening %v: %v", *filename, err)
+		return nil, 0, fmt.Errorf("Error opening %v: %v", entry.File, err)
 	}
+	defer file.Close()
 	fi, err := file.Stat()
 	if err != nil {
-		log.Fatalf("Error obtaining file size %v: %v", *filename, err)
+		return nil, 0, fmt.Errorf("Error obtaining file size %v: %v", entry.File, err)
 	}
 
 	size := fi.Size()
+	if size == 0 {
+		return nil, 0, fmt.Errorf("No video data to upload in %s", entry.File)
+	}
 
-	call.ResumableMedia(context.TODO(), file, size, "")
+	var response *youtube.Video
+	if state != nil {
+		if !state.matches(fi) {
+			return nil, 0, fmt.Errorf("%s has been modified since the upload was interrupted", entry.File)
+		}
+		err = u.retry.do(ctx, "Querying upload session", func() (err error) {
+			state.Offset, response, err = queryUploadOffset(ctx, u.client, state)
+			return err
+		})
+		if err != nil {
+			return nil, 0, fmt.Errorf("Error querying upload session: %v", err)
+		}
+		if response != nil {
+			// The previous process died after the last byte was sent.
+			state.Offset = size
+		}
+		log.Printf("Resuming from %d KB / %d KB\n", state.Offset/1024, size/1024)
+	} else {
+		if old, _ := loadUploadState(entry.File); old != nil && old.VideoId == "" {
+			log.Printf("Discarding interrupted upload of %s\n", old.Filename)
+		}
+		var sessionURI string
+		err = u.retry.do(ctx, "Starting upload session", func() (err error) {
+			sessionURI, err = startUploadSession(ctx, u.client, upload, size)
+			return err
+		})
+		if err != nil {
+			return nil, 0, fmt.Errorf("Error starting upload session: %v", err)
+		}
+		state = &uploadState{
+			SessionURI: sessionURI,
+			Filename:   absPath(entry.File),
+			Size:       size,
+			ModTime:    fi.ModTime(),
+		}
+		if err := saveUploadState(state); err != nil {
+			log.Printf("Error saving state file: %v", err)
+		}
+	}
+	startOffset := state.Offset
+
+	lastPercent = 0
+	if response == nil {
+		response, err = uploadMedia(ctx, u.client, u.retry, state, file)
+		if err != nil && ctx.Err() != nil {
+			if terminal.IsTerminal(syscall.Stdout) {
+				fmt.Printf("\n")
+			}
+			if err := saveUploadState(state); err != nil {
+				log.Printf("Error saving state file: %v", err)
+			}
+			percent := int64(100)
+			if size > 0 {
+				percent = state.Offset * 100 / size
+			}
+			return nil, 0, fmt.Errorf("Interrupted after %d KB / %d KB (%d%%) of %s (run with -resume to continue)", state.Offset/1024, size/1024, percent, entry.File)
+		}
+		if err != nil {
+			return nil, 0, fmt.Errorf("Error uploading video (run with -resume to continue): %v", err)
+		}
+	}
+	// Kept until the caller knows it's no longer needed; see main.
+	state.VideoId = response.Id
+	if err := saveUploadState(state); err != nil {
+		log.Printf("Error saving state file: %v", err)
+	}
+	return response, size - startOffset, nil
+}
 
-	start := time.Now()
+// resolveCategories replaces category names in entries with their IDs.
+func (u *uploader) resolveCategories(ctx context.Context, entries []*manifestEntry) error {
+	var categories []videoCategory
+	for _, e := range entries {
+		if e.Category == "" || isCategoryId(e.Category) {
+			continue
+		}
+		if categories == nil {
+			var err error
+			categories, err = loadCategories(ctx, u.service, u.retry, *region)
+			if err != nil {
+				return err
+			}
+		}
+		id, err := resolveCategory(categories, e.Category)
+		if err != nil {
+			return err
+		}
+		e.Category = id
+	}
+	return nil
+}
+
+// newService authenticates and returns the client and YouTube service.
+func newService(ctx context.Context) (*http.Client, *youtube.Service) {
+	log.Printf("Requesting auth token...\n")
 
-	response, err := call.Do()
+	client, err := buildOAuthHTTPClient(ctx, SCOPE)
 	if err != nil {
-		log.Fatalf("Error making YouTube API call: %v", err)
+		log.Fatalf("Error building OAuth client: %v", err)
 	}
-	end := time.Now()
 
-	duration := end.Sub(start)
+	service, err := youtube.New(client)
+	if err != nil {
+		log.Fatalf("Error creating YouTube client: %v", err)
+	}
+	return client, service
+}
 
-	oneHundreadMegMinutes := float64(duration.Minutes() * 100.0 * 1024.0 * 1024.0 / float64(size))
-	if terminal.IsTerminal(syscall.Stdout) {
-		fmt.Printf("\n")
+// runCommand runs a subcommand such as "yt-up accounts list".
+func runCommand(ctx context.Context, args []string) error {
+	switch args[0] {
+	case "accounts":
+		return accountsCommand(args[1:])
+	case "auth":
+		return authCommand(ctx, args[1:])
+	case "logout":
+		return logoutCommand(ctx, args[1:])
 	}
+	return fmt.Errorf("Unknown command %q", args[0])
+}
+
+func main() {
+	flag.Parse()
 
-	log.Printf("Uploaded %.1f MB in %s, %.1f minutes for 100MB : http://youtube.com/watch?v=%v\n", float64(size)/(1024.0*1024.0), duration, oneHundreadMegMinutes, response.Id)
+	bashcomp.HandleBashCompletion()
 
-	if *playlist != "" {
-		playlistId := findPlaylist(service, *playlist)
-		if playlistId != "" {
-			log.Printf("Playlist found: %s\n", playlistId)
+	if err := loadConfig(); err != nil {
+		log.Fatalf("Error reading config: %v", err)
+	}
+	if *account == "default" {
+		*account = ""
+	}
+	if err := checkAccountName(*account); err != nil {
+		log.Fatalf("%v", err)
+	}
+	if *authMode != "browser" && *authMode != "device" {
+		log.Fatalf("-auth-mode must be browser or device")
+	}
+	if err := checkTokenStore(); err != nil {
+		log.Fatalf("%v", err)
+	}
+	if err := checkRetryFlags(); err != nil {
+		log.Fatalf("%v", err)
+	}
+	if *showConfig {
+		printConfig()
+		return
+	}
+
+	// The first SIGINT or SIGTERM aborts the upload, including the chunk in
+	// flight, leaving it resumable from the last chunk the server confirmed;
+	// another one kills the process.
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	go func() {
+		<-ctx.Done()
+		stop()
+	}()
+
+	if flag.NArg() > 0 {
+		if err := runCommand(ctx, flag.Args()); err != nil {
+			log.Fatalf("%v", err)
+		}
+		return
+	}
+
+	if *listCategories {
+		_, service := newService(ctx)
+		categories, err := loadCategories(ctx, service, newRetryPolicy(), *region)
+		if err != nil {
+			log.Fatalf("%v", err)
+		}
+		printCategories(categories)
+		return
+	}
+
+	var entries []*manifestEntry
+	var state *uploadState
+	if *manifest != "" {
+		if *filename != "" || *follow {
+			log.Fatalf("-manifest can't be used with -filename or -follow")
+		}
+		if len(captions) > 0 {
+			log.Fatalf("-caption can't be used with -manifest; list each video's captions in the manifest")
+		}
+		var err error
+		entries, err = readManifest(*manifest)
+		if err != nil {
+			log.Fatalf("Error reading manifest: %v", err)
+		}
+		if len(entries) == 0 {
+			log.Fatalf("No videos listed in %s", *manifest)
+		}
+		for _, e := range entries {
+			e.applyDefaults()
+		}
+	} else {
+		if *resume && !isStream(*filename) {
+			var err error
+			state, err = resumableState(*filename)
+			if err != nil {
+				log.Fatalf("%v", err)
+			}
+			*filename = state.Filename
+		}
+
+		if *filename == "" {
+			log.Fatalf("Specify a filename of a video file with -filename")
+		}
+		if isStream(*filename) && *resume {
+			log.Fatalf("Uploads from stdin or with -follow can't be resumed")
+		}
+		if *filename == "-" && *follow {
+			log.Fatalf("-follow needs a file, not stdin")
+		}
+		entries = []*manifestEntry{entryFromFlags()}
+	}
+
+	scheduled, err := publishTime()
+	if err != nil {
+		log.Fatalf("Error in -publish-at: %v", err)
+	}
+	for _, e := range entries {
+		e.PublishAt = scheduled
+	}
+
+	for _, e := range entries {
+		if e.Thumbnail == "" {
+			continue
+		}
+		if _, err := validateThumbnail(e.Thumbnail); err != nil {
+			log.Fatalf("Bad thumbnail for %s: %v", e.File, err)
+		}
+	}
+	for _, e := range entries {
+		for _, t := range e.Captions {
+			if err := validateCaptions(t.Path); err != nil {
+				log.Fatalf("Bad caption file for %s: %v", e.File, err)
+			}
+		}
+	}
+
+	// Check all the videos before uploading any, so every broken one is
+	// reported at once.
+	broken := 0
+	for _, e := range entries {
+		if isStream(e.File) {
+			continue
+		}
+		if err := preflight(ctx, e.File); err != nil {
+			log.Printf("%v", err)
+			broken++
+		}
+	}
+	if broken > 0 {
+		log.Fatalf("%d of %d videos failed the check; use -force to upload anyway", broken, len(entries))
+	}
+
+	client, service := newService(ctx)
+
+	u := newUploader(client, service, newRetryPolicy())
+
+	// Make it obvious which channel the videos are going to.
+	var channel string
+	err = u.retry.do(ctx, "Getting channel", func() (err error) {
+		channel, err = channelTitle(ctx, service)
+		return err
+	})
+	if err != nil {
+		log.Fatalf("%v", err)
+	}
+	log.Printf("Uploading to channel %q (account %s)\n", channel, accountLabel(*account))
+	// With -service-account, the channel isn't the -account's.
+	if *serviceAccount == "" {
+		saveChannelTitle(*account, channel)
+	}
+
+	if err := u.resolveCategories(ctx, entries); err != nil {
+		log.Fatalf("%v", err)
+	}
+
+	if *manifest == "" {
+		response, _, err := u.upload(ctx, entries[0], state)
+		if response != nil {
+			removeUploadState(entries[0].File)
+		}
+		if err != nil {
+			log.Fatalf("%v", err)
+		}
+		return
+	}
+
+	results := make([]string, len(entries))
+	failed := 0
+	for i, e := range entries {
+		var state *uploadState
+		if *resume && !isStream(e.File) {
+			state, err = loadUploadState(e.File)
+			if err != nil {
+				log.Fatalf("Error reading upload state: %v", err)
+			}
+			if fi, err := os.Stat(e.File); state != nil && err == nil && !state.matches(fi) {
+				log.Printf("%s has changed since it was last uploaded; uploading it again\n", e.File)
+				state = nil
+			}
+			if state != nil && state.Finished {
+				log.Printf("Skipping %s, uploaded before\n", e.File)
+				results[i] = fmt.Sprintf("OK     %s: http://youtube.com/watch?v=%v (uploaded before)", e.File, state.VideoId)
+				continue
+			}
+		}
+		var videoId string
+		var report []string
+		if state != nil && state.VideoId != "" {
+			// Only the thumbnail, playlist or captions failed last time.
+			log.Printf("Finishing %s, uploaded before as %s\n", e.File, state.VideoId)
+			videoId = state.VideoId
+			report, err = u.finish(ctx, e, videoId, true)
+		} else {
+			var response *youtube.Video
+			response, report, err = u.upload(ctx, e, state)
+			if response != nil {
+				videoId = response.Id
+			}
+		}
+		if err != nil {
+			failed++
+			log.Printf("%v", err)
+			results[i] = fmt.Sprintf("FAILED %s: %v", e.File, err)
+			if len(report) > 0 {
+				results[i] += "; captions: " + strings.Join(report, ", ")
+			}
+			if ctx.Err() != nil || oauth.IsCode(err, "invalid_grant") {
+				// The rest would fail the same way.
+				if ctx.Err() == nil {
+					log.Printf("The authorization has been revoked or has expired; run again to authorize\n")
+				}
+				for j := i + 1; j < len(entries); j++ {
+					failed++
+					results[j] = fmt.Sprintf("SKIPPED %s", entries[j].File)
+				}
+				break
+			}
 		} else {
-			playlistId = createPlaylist(service, *playlist)
-			log.Printf("Playlist created: id=%s", playlistId)
+			results[i] = fmt.Sprintf("OK     %s: http://youtube.com/watch?v=%v", e.File, videoId)
+			if !e.PublishAt.IsZero() {
+				results[i] += ", publishes at " + formatPublishTime(e.PublishAt)
+			}
+			if len(report) > 0 {
+				results[i] += ", captions: " + strings.Join(report, ", ")
+			}
 		}
-		addToPlaylist(service, response.Id, playlistId)
-		log.Printf("Video added to playlist")
+	}
+
+	log.Printf("%d of %d videos uploaded\n", len(entries)-failed, len(entries))
+	for _, r := range results {
+		log.Printf("  %s\n", r)
+	}
+	if failed > 0 {
+		log.Printf("Run again with -resume to upload the rest\n")
+		os.Exit(1)
+	}
+	// Nothing is left to resume.
+	for _, e := range entries {
+		removeUploadState(e.File)
 	}
 }
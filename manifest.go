@@ -0,0 +1,182 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v2"
+)
+
+// manifestEntry describes a single video to upload. Without -manifest,
+// one is built from the command line flags.
+type manifestEntry struct {
+	File        string   `json:"file" yaml:"file"`
+	Title       string   `json:"title" yaml:"title"`
+	Description string   `json:"description" yaml:"description"`
+	Tags        []string `json:"tags" yaml:"tags"`
+	Privacy     string   `json:"privacy" yaml:"privacy"`
+	Playlist    string   `json:"playlist" yaml:"playlist"`
+	Category    string   `json:"category" yaml:"category"`
+	Thumbnail   string   `json:"thumbnail" yaml:"thumbnail"`
+
+	// CaptionSpecs are caption tracks as lang:path[:name], like -caption.
+	// In a CSV, they're separated by semicolons.
+	CaptionSpecs []string        `json:"captions" yaml:"captions"`
+	Captions     []*captionTrack `json:"-" yaml:"-"`
+
+	// PublishAt is set from -publish-at; zero means publish immediately.
+	PublishAt time.Time `json:"-" yaml:"-"`
+}
+
+// readManifest reads a list of entries from a YAML, JSON or CSV file,
+// chosen by the file extension. Relative file names in the manifest are
+// resolved against the directory of the manifest.
+func readManifest(path string) ([]*manifestEntry, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var entries []*manifestEntry
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(data, &entries)
+	case ".json":
+		err = json.Unmarshal(data, &entries)
+	case ".csv":
+		entries, err = readManifestCSV(bytes.NewReader(data))
+	default:
+		return nil, fmt.Errorf("Unknown manifest format %s; use .yaml, .json or .csv", path)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("Error parsing %s: %v", path, err)
+	}
+
+	dir := filepath.Dir(path)
+	for i, e := range entries {
+		if e == nil || e.File == "" {
+			return nil, fmt.Errorf("Entry %d in %s has no file", i+1, path)
+		}
+		e.File = resolvePath(dir, e.File)
+		if e.Thumbnail != "" {
+			e.Thumbnail = resolvePath(dir, e.Thumbnail)
+		}
+		var tracks captionFlags
+		for _, spec := range e.CaptionSpecs {
+			if err := tracks.Set(spec); err != nil {
+				return nil, fmt.Errorf("Entry %d in %s has a bad caption: %v", i+1, path, err)
+			}
+		}
+		for _, t := range tracks {
+			t.Path = resolvePath(dir, t.Path)
+		}
+		e.Captions = tracks
+	}
+	return entries, nil
+}
+
+func resolvePath(dir, path string) string {
+	if filepath.IsAbs(path) {
+		return path
+	}
+	return filepath.Join(dir, path)
+}
+
+// readManifestCSV reads a CSV with a header row naming the columns.
+// Tags are comma separated within their column.
+func readManifestCSV(r io.Reader) ([]*manifestEntry, error) {
+	rows, err := csv.NewReader(r).ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	if len(rows) == 0 {
+		return nil, nil
+	}
+
+	var entries []*manifestEntry
+	header := rows[0]
+	for _, row := range rows[1:] {
+		e := &manifestEntry{}
+		for i, value := range row {
+			value = strings.TrimSpace(value)
+			switch strings.ToLower(strings.TrimSpace(header[i])) {
+			case "file":
+				e.File = value
+			case "title":
+				e.Title = value
+			case "description":
+				e.Description = value
+			case "tags":
+				e.Tags = splitTags(value)
+			case "privacy":
+				e.Privacy = value
+			case "playlist":
+				e.Playlist = value
+			case "category":
+				e.Category = value
+			case "thumbnail":
+				e.Thumbnail = value
+			case "captions":
+				for _, spec := range strings.Split(value, ";") {
+					if spec = strings.TrimSpace(spec); spec != "" {
+						e.CaptionSpecs = append(e.CaptionSpecs, spec)
+					}
+				}
+			default:
+				return nil, fmt.Errorf("Unknown column %q", header[i])
+			}
+		}
+		entries = append(entries, e)
+	}
+	return entries, nil
+}
+
+// splitTags splits a comma separated list of tags.
+// The API returns a 400 Bad Request response if tags is an empty string.
+func splitTags(s string) []string {
+	var tags []string
+	for _, t := range strings.Split(s, ",") {
+		if t = strings.TrimSpace(t); t != "" {
+			tags = append(tags, t)
+		}
+	}
+	return tags
+}
+
+// entryFromFlags builds an entry from the command line flags.
+func entryFromFlags() *manifestEntry {
+	return &manifestEntry{
+		File:        *filename,
+		Title:       *title,
+		Description: *description,
+		Tags:        splitTags(*keywords),
+		Privacy:     *privacy,
+		Playlist:    *playlist,
+		Category:    *category,
+		Thumbnail:   *thumbnail,
+		Captions:    captions,
+	}
+}
+
+// applyDefaults fills in fields left empty in a manifest from the flags.
+func (e *manifestEntry) applyDefaults() {
+	if e.Privacy == "" {
+		e.Privacy = *privacy
+	}
+	if e.Playlist == "" {
+		e.Playlist = *playlist
+	}
+	if e.Category == "" {
+		e.Category = *category
+	}
+	if len(e.Tags) == 0 {
+		e.Tags = splitTags(*keywords)
+	}
+}
@@ -0,0 +1,270 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"math"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var force = flag.Bool("force", false, "Upload even if ffprobe finds the video broken")
+
+// Formats YouTube processes well; others may work, but slowly or badly.
+var (
+	goodContainers  = []string{"mov", "mp4", "matroska", "webm", "avi", "flv", "mpegts", "3gp"}
+	goodVideoCodecs = []string{"h264", "hevc", "vp8", "vp9", "av1", "mpeg4", "mpeg2video", "prores", "dnxhd"}
+	goodAudioCodecs = []string{"aac", "mp3", "opus", "vorbis", "ac3", "eac3", "flac", "alac", "pcm_s16le", "pcm_s24le"}
+)
+
+// probeOutput is the part of "ffprobe -print_format json -show_format
+// -show_streams" output that's checked.
+type probeOutput struct {
+	Streams []probeStream `json:"streams"`
+	Format  struct {
+		FormatName string `json:"format_name"`
+		Duration   string `json:"duration"`
+	} `json:"format"`
+}
+
+type probeStream struct {
+	CodecType    string `json:"codec_type"`
+	CodecName    string `json:"codec_name"`
+	Width        int    `json:"width"`
+	Height       int    `json:"height"`
+	AvgFrameRate string `json:"avg_frame_rate"`
+	RFrameRate   string `json:"r_frame_rate"`
+	Channels     int    `json:"channels"`
+	Duration     string `json:"duration"`
+	Disposition  struct {
+		AttachedPic int `json:"attached_pic"`
+	} `json:"disposition"`
+
+	// Older ffprobe versions report rotation as a tag, newer ones as a
+	// display matrix.
+	Tags struct {
+		Rotate string `json:"rotate"`
+	} `json:"tags"`
+	SideDataList []struct {
+		SideDataType string  `json:"side_data_type"`
+		Rotation     float64 `json:"rotation"`
+	} `json:"side_data_list"`
+}
+
+// mediaInfo describes a video file as ffprobe sees it.
+type mediaInfo struct {
+	Containers    []string // ffprobe lists every name of the demuxer, e.g. "mov,mp4,m4a".
+	Duration      time.Duration
+	VideoCodec    string
+	Width, Height int // As displayed, i.e. after rotation.
+	Rotation      int // Degrees clockwise: 0, 90, 180 or 270.
+	FrameRate     float64
+	AudioCodec    string
+	AudioChannels int
+}
+
+// parseProbe parses ffprobe's JSON output.
+func parseProbe(data []byte) (*mediaInfo, error) {
+	var out probeOutput
+	if err := json.Unmarshal(data, &out); err != nil {
+		return nil, fmt.Errorf("Error parsing ffprobe output: %v", err)
+	}
+	info := &mediaInfo{Duration: parseSeconds(out.Format.Duration)}
+	if out.Format.FormatName != "" {
+		info.Containers = strings.Split(out.Format.FormatName, ",")
+	}
+	for _, s := range out.Streams {
+		switch s.CodecType {
+		case "video":
+			// Cover art is a video stream too.
+			if info.VideoCodec != "" || s.Disposition.AttachedPic != 0 {
+				continue
+			}
+			info.VideoCodec = s.CodecName
+			info.Width, info.Height = s.Width, s.Height
+			info.Rotation = s.rotation()
+			if info.Rotation == 90 || info.Rotation == 270 {
+				info.Width, info.Height = info.Height, info.Width
+			}
+			info.FrameRate = parseRate(s.AvgFrameRate)
+			if info.FrameRate == 0 {
+				info.FrameRate = parseRate(s.RFrameRate)
+			}
+			if info.Duration == 0 {
+				info.Duration = parseSeconds(s.Duration)
+			}
+		case "audio":
+			if info.AudioCodec != "" {
+				continue
+			}
+			info.AudioCodec = s.CodecName
+			info.AudioChannels = s.Channels
+		}
+	}
+	return info, nil
+}
+
+// rotation returns how far the stream is rotated when played, in degrees
+// clockwise.
+func (s *probeStream) rotation() int {
+	var deg float64
+	if s.Tags.Rotate != "" {
+		deg, _ = strconv.ParseFloat(s.Tags.Rotate, 64)
+	} else {
+		for _, sd := range s.SideDataList {
+			if sd.SideDataType == "Display Matrix" {
+				// The display matrix rotates counterclockwise.
+				deg = -sd.Rotation
+			}
+		}
+	}
+	return ((int(math.Round(deg/90))*90)%360 + 360) % 360
+}
+
+// parseSeconds parses a duration such as "123.456000"; anything else is 0.
+func parseSeconds(s string) time.Duration {
+	secs, err := strconv.ParseFloat(s, 64)
+	if err != nil || secs < 0 {
+		return 0
+	}
+	return time.Duration(secs * float64(time.Second))
+}
+
+// parseRate parses a frame rate such as "30000/1001"; anything else is 0.
+func parseRate(s string) float64 {
+	num, den, ok := strings.Cut(s, "/")
+	if !ok {
+		den = "1"
+	}
+	n, err1 := strconv.ParseFloat(num, 64)
+	d, err2 := strconv.ParseFloat(den, 64)
+	if err1 != nil || err2 != nil || d == 0 {
+		return 0
+	}
+	return n / d
+}
+
+func (info *mediaInfo) String() string {
+	parts := []string{strings.Join(info.Containers, "/")}
+	if info.VideoCodec != "" {
+		parts = append(parts, fmt.Sprintf("%s %dx%d %.2f fps", info.VideoCodec, info.Width, info.Height, info.FrameRate))
+		if info.Rotation != 0 {
+			parts = append(parts, fmt.Sprintf("rotated %d", info.Rotation))
+		}
+	} else {
+		parts = append(parts, "no video")
+	}
+	if info.AudioCodec != "" {
+		parts = append(parts, fmt.Sprintf("%s %dch", info.AudioCodec, info.AudioChannels))
+	} else {
+		parts = append(parts, "no audio")
+	}
+	parts = append(parts, info.Duration.Round(time.Second).String())
+	return strings.Join(parts, ", ")
+}
+
+func isOneOf(s string, list []string) bool {
+	for _, l := range list {
+		if s == l {
+			return true
+		}
+	}
+	return false
+}
+
+// checkMedia returns what's wrong with the video: problems that make
+// YouTube reject it, and warnings about things it handles poorly.
+func checkMedia(info *mediaInfo) (problems []string, warnings []string) {
+	if info.VideoCodec == "" {
+		problems = append(problems, "no video stream")
+	} else if info.Width <= 0 || info.Height <= 0 {
+		problems = append(problems, "no video resolution")
+	}
+	if info.Duration <= 0 {
+		problems = append(problems, "unknown or zero duration")
+	}
+
+	container := false
+	for _, c := range info.Containers {
+		container = container || isOneOf(c, goodContainers)
+	}
+	if !container && len(info.Containers) > 0 {
+		warnings = append(warnings, fmt.Sprintf("container %s is not one YouTube recommends", strings.Join(info.Containers, "/")))
+	}
+	if info.VideoCodec != "" && !isOneOf(info.VideoCodec, goodVideoCodecs) {
+		warnings = append(warnings, fmt.Sprintf("video codec %s may be processed poorly; H.264 is safest", info.VideoCodec))
+	}
+	if info.Width > 0 && info.Height > 0 && info.Width < 426 && info.Height < 426 {
+		warnings = append(warnings, fmt.Sprintf("resolution %dx%d is below 240p", info.Width, info.Height))
+	}
+	if info.Width%2 != 0 || info.Height%2 != 0 {
+		warnings = append(warnings, fmt.Sprintf("odd resolution %dx%d may be cropped or padded", info.Width, info.Height))
+	}
+	if info.FrameRate > 0 && (info.FrameRate < 10 || info.FrameRate > 120) {
+		warnings = append(warnings, fmt.Sprintf("frame rate %.2f fps is unusual", info.FrameRate))
+	}
+	if info.AudioCodec == "" {
+		warnings = append(warnings, "no audio track")
+	} else if !isOneOf(info.AudioCodec, goodAudioCodecs) {
+		warnings = append(warnings, fmt.Sprintf("audio codec %s may be processed poorly; AAC is safest", info.AudioCodec))
+	}
+	return problems, warnings
+}
+
+// probeMedia runs ffprobe on the file. It returns nil without an error
+// if ffprobe isn't installed.
+func probeMedia(ctx context.Context, path string) (*mediaInfo, error) {
+	ffprobe, err := exec.LookPath("ffprobe")
+	if err != nil {
+		return nil, nil
+	}
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, ffprobe, "-v", "error", "-print_format", "json", "-show_format", "-show_streams", path)
+	cmd.Stdout, cmd.Stderr = &stdout, &stderr
+	if err := cmd.Run(); err != nil {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
+			return nil, fmt.Errorf("ffprobe can't read %s: %s", path, strings.TrimSpace(stderr.String()))
+		}
+		return nil, fmt.Errorf("Error running ffprobe: %v", err)
+	}
+	return parseProbe(stdout.Bytes())
+}
+
+// preflight checks the video with ffprobe before it's uploaded. It fails
+// for a broken file unless -force is given.
+func preflight(ctx context.Context, path string) error {
+	info, err := probeMedia(ctx, path)
+	if err != nil {
+		if *force {
+			log.Printf("%v; uploading anyway because of -force\n", err)
+			return nil
+		}
+		return err
+	}
+	if info == nil {
+		log.Printf("ffprobe not found; skipping the check of %s\n", path)
+		return nil
+	}
+
+	log.Printf("%s: %v\n", path, info)
+	problems, warnings := checkMedia(info)
+	for _, w := range warnings {
+		log.Printf("Warning: %s: %s\n", path, w)
+	}
+	if len(problems) == 0 {
+		return nil
+	}
+	if *force {
+		log.Printf("%s is broken (%s); uploading anyway because of -force\n", path, strings.Join(problems, ", "))
+		return nil
+	}
+	return fmt.Errorf("%s is broken (%s)", path, strings.Join(problems, ", "))
+}
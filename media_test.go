@@ -0,0 +1,127 @@
+package main
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseProbe(t *testing.T) {
+	for _, test := range []struct {
+		file     string
+		want     mediaInfo
+		problems []string // Substrings of each problem, in order.
+		warnings []string // Substrings of each warning, in order.
+	}{
+		{
+			file: "valid.json",
+			want: mediaInfo{
+				Containers: []string{"mov", "mp4", "m4a", "3gp", "3g2", "mj2"},
+				Duration:   125125 * time.Millisecond,
+				VideoCodec: "h264", Width: 1920, Height: 1080, FrameRate: 30000.0 / 1001,
+				AudioCodec: "aac", AudioChannels: 2,
+			},
+		},
+		{
+			// The cover art doesn't count as video.
+			file: "novideo.json",
+			want: mediaInfo{
+				Containers: []string{"mp3"},
+				Duration:   time.Duration(241.632653 * float64(time.Second)),
+				AudioCodec: "mp3", AudioChannels: 2,
+			},
+			problems: []string{"no video stream"},
+			warnings: []string{"container mp3"},
+		},
+		{
+			file: "badcodec.json",
+			want: mediaInfo{
+				Containers: []string{"asf"},
+				Duration:   time.Minute,
+				VideoCodec: "wmv3", Width: 1280, Height: 720, FrameRate: 25,
+				AudioCodec: "wmav2", AudioChannels: 2,
+			},
+			warnings: []string{"container asf", "video codec wmv3", "audio codec wmav2"},
+		},
+		{
+			file: "zeroduration.json",
+			want: mediaInfo{
+				Containers: []string{"mov", "mp4", "m4a", "3gp", "3g2", "mj2"},
+				VideoCodec: "h264", Width: 1280, Height: 720, FrameRate: 30,
+			},
+			problems: []string{"zero duration"},
+			warnings: []string{"no audio track"},
+		},
+		{
+			// Recorded in landscape, displayed in portrait.
+			file: "rotated.json",
+			want: mediaInfo{
+				Containers: []string{"mov", "mp4", "m4a", "3gp", "3g2", "mj2"},
+				Duration:   12 * time.Second,
+				VideoCodec: "hevc", Width: 1080, Height: 1920, Rotation: 90, FrameRate: 30,
+				AudioCodec: "aac", AudioChannels: 1,
+			},
+		},
+		{
+			file: "oddsize.json",
+			want: mediaInfo{
+				Containers: []string{"mov", "mp4", "m4a", "3gp", "3g2", "mj2"},
+				Duration:   30 * time.Second,
+				VideoCodec: "h264", Width: 853, Height: 481, Rotation: 180, FrameRate: 24,
+				AudioCodec: "aac", AudioChannels: 2,
+			},
+			warnings: []string{"odd resolution 853x481"},
+		},
+	} {
+		data, err := ioutil.ReadFile(filepath.Join("testdata", "ffprobe", test.file))
+		if err != nil {
+			t.Fatal(err)
+		}
+		info, err := parseProbe(data)
+		if err != nil {
+			t.Errorf("%s: %v", test.file, err)
+			continue
+		}
+		if info.String() != test.want.String() || info.Rotation != test.want.Rotation {
+			t.Errorf("%s: got %v (rotated %d), want %v (rotated %d)", test.file, info, info.Rotation, &test.want, test.want.Rotation)
+		}
+		problems, warnings := checkMedia(info)
+		checkMessages(t, test.file+" problems", problems, test.problems)
+		checkMessages(t, test.file+" warnings", warnings, test.warnings)
+	}
+}
+
+func checkMessages(t *testing.T, what string, got []string, want []string) {
+	t.Helper()
+	if len(got) != len(want) {
+		t.Errorf("%s: got %q, want %q", what, got, want)
+		return
+	}
+	for i := range want {
+		if !strings.Contains(got[i], want[i]) {
+			t.Errorf("%s: got %q, want %q", what, got, want)
+			return
+		}
+	}
+}
+
+func TestParseProbeBadJSON(t *testing.T) {
+	if _, err := parseProbe([]byte("not json")); err == nil {
+		t.Errorf("parseProbe accepted bad JSON")
+	}
+}
+
+func TestParseRate(t *testing.T) {
+	for s, want := range map[string]float64{
+		"30000/1001": 30000.0 / 1001,
+		"25":         25,
+		"0/0":        0,
+		"":           0,
+	} {
+		if got := parseRate(s); got != want {
+			t.Errorf("parseRate(%q) = %v, want %v", s, got, want)
+		}
+	}
+}
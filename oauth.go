@@ -1,22 +1,46 @@
 package main
 
 import (
+	"context"
+	"crypto/subtle"
 	"errors"
+	"flag"
 	"fmt"
+	"html/template"
 	"log"
 	"net"
 	"net/http"
+	"net/url"
 	"os"
 	"os/exec"
 	"os/user"
 	"runtime"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/omakoto/yt-up/oauth"
+	"golang.org/x/oauth2"
 )
 
 const (
 	CLIENT_ID_ENV     = "YT_UP_CLIENT_ID"
 	CLIENT_SECRET_ENV = "YT_UP_CLIENT_SECRET"
+
+	// The device flow doesn't allow youtube.upload, but youtube includes it.
+	DEVICE_SCOPE = "https://www.googleapis.com/auth/youtube"
+
+	REVOKE_URL    = "https://oauth2.googleapis.com/revoke"
+	TOKENINFO_URL = "https://oauth2.googleapis.com/tokeninfo"
+)
+
+var (
+	authMode    = flag.String("auth-mode", "browser", "How to authorize: browser, or device to enter a code on another device")
+	authTimeout = flag.Duration("auth-timeout", 5*time.Minute, "How long to wait for authorization in the browser")
+	expirySkew  = flag.Duration("token-expiry-skew", oauth.DefaultExpirySkew, "Refresh access tokens this long before they expire, to allow for clock skew")
+
+	serviceAccount = flag.String("service-account", "", "Service account key JSON file; authorizes without a browser, e.g. in CI")
+	impersonate    = flag.String("impersonate", "", "With -service-account, the Workspace user to act as, via domain-wide delegation")
 )
 
 // openURL opens a browser window to the specified location.
@@ -45,101 +69,294 @@ func getHomeDir() string {
 	return usr.HomeDir
 }
 
-func buildConfig(scope string) (*oauth.Config, error) {
-	clientId := os.Getenv(CLIENT_ID_ENV)
-	if clientId == "" {
-		log.Fatalf("You must provide an oauth client ID via " + CLIENT_ID_ENV)
+func buildConfig(scope string) (*oauth2.Config, error) {
+	config := &oauth2.Config{
+		ClientID:     os.Getenv(CLIENT_ID_ENV),
+		ClientSecret: os.Getenv(CLIENT_SECRET_ENV),
+		Scopes:       strings.Fields(scope),
+		Endpoint: oauth2.Endpoint{
+			AuthURL:       "https://accounts.google.com/o/oauth2/auth",
+			TokenURL:      "https://oauth2.googleapis.com/token",
+			DeviceAuthURL: "https://oauth2.googleapis.com/device/code",
+			AuthStyle:     oauth2.AuthStyleInParams,
+		},
+	}
+
+	// A client secrets file from a flag overrides the environment; one from
+	// the config file doesn't.
+	if *clientSecrets != "" && (config.ClientID == "" || settingSource("client-secrets") == "-client-secrets") {
+		info, err := readClientSecrets(*clientSecrets)
+		if err != nil {
+			return nil, err
+		}
+		config.ClientID = info.ClientId
+		config.ClientSecret = info.ClientSecret
+		config.Endpoint.AuthURL = info.AuthURI
+		config.Endpoint.TokenURL = info.TokenURI
+		if info.web {
+			config.RedirectURL, err = info.loopbackRedirectURI()
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if config.ClientID == "" {
+		return nil, fmt.Errorf("You must provide an oauth client with -client-secrets or via " + CLIENT_ID_ENV)
 	}
 
-	clientSecret := os.Getenv(CLIENT_SECRET_ENV)
-	if clientSecret == "" {
-		log.Fatalf("You must provide an oauth client secret via " + CLIENT_SECRET_ENV)
+	if config.ClientSecret == "" {
+		return nil, fmt.Errorf("You must provide an oauth client secret via " + CLIENT_SECRET_ENV)
 	}
 
-	return &oauth.Config{
-		ClientId:       clientId,
-		ClientSecret:   clientSecret,
-		Scope:          scope,
-		AuthURL:        "https://accounts.google.com/o/oauth2/auth",
-		TokenURL:       "https://accounts.google.com/o/oauth2/token",
-		RedirectURL:    "http://localhost:8080/",
-		TokenCache:     oauth.CacheFile(getHomeDir() + "/.yt-up.oauth.cache"),
-		AccessType:     "offline",
-		ApprovalPrompt: "force",
-	}, nil
+	return config, nil
+}
+
+var resultPage = template.Must(template.New("result").Parse(`<!DOCTYPE html>
+<html><head><meta charset="utf-8"><title>yt-up</title></head>
+<body style="font-family: sans-serif; margin: 3em">
+{{if .Error}}<h2>Authorization failed</h2><p>{{.Error}}</p>
+{{else}}<h2>Authorization complete</h2><p>You can now safely close this browser window.</p>
+{{end}}</body></html>
+`))
+
+func writeResultPage(w http.ResponseWriter, status int, errMsg string) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(status)
+	resultPage.Execute(w, struct{ Error string }{errMsg})
+}
+
+// authResult is what the web server receives in the redirect.
+type authResult struct {
+	code string
+	err  error
 }
 
-// startWebServer starts a web server that listens on http://localhost:8080.
+func isLoopbackURL(uri string) bool {
+	u, err := url.Parse(uri)
+	if err != nil || u.Scheme != "http" {
+		return false
+	}
+	switch u.Hostname() {
+	case "localhost", "127.0.0.1", "::1":
+		return true
+	}
+	return false
+}
+
+// listenLoopback listens on a free port on the IPv4 loopback address, or the
+// IPv6 one if there's no IPv4.
+func listenLoopback() (net.Listener, error) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err == nil {
+		return listener, nil
+	}
+	listener, err6 := net.Listen("tcp", "[::1]:0")
+	if err6 == nil {
+		return listener, nil
+	}
+	return nil, fmt.Errorf("Cannot listen on a loopback address: %v; %v", err, err6)
+}
+
+// startWebServer starts a web server that listens on redirectURL, or on a
+// free loopback port if it's empty, and returns the redirect URL.
 // The webserver waits for an oauth code in the three-legged auth flow.
-func startWebServer() (codeCh chan string, err error) {
-	listener, err := net.Listen("tcp", "localhost:8080")
-	if err != nil {
-		return nil, err
+// Requests to other paths or without the expected state are rejected, so
+// another page or process can't inject a code.
+func startWebServer(state string, redirectURL string) (resultCh chan authResult, _ string, err error) {
+	var listener net.Listener
+	path := "/"
+	if redirectURL == "" {
+		listener, err = listenLoopback()
+		if err != nil {
+			return nil, "", err
+		}
+		redirectURL = "http://" + listener.Addr().String() + "/"
+	} else {
+		u, err := url.Parse(redirectURL)
+		if err != nil {
+			return nil, "", err
+		}
+		host := u.Host
+		if u.Port() == "" {
+			host += ":80"
+		}
+		listener, err = net.Listen("tcp", host)
+		if err != nil {
+			return nil, "", fmt.Errorf("Cannot listen on the client's redirect URI %s: %v", redirectURL, err)
+		}
+		if u.Path != "" {
+			path = u.Path
+		}
 	}
-	codeCh = make(chan string)
+	resultCh = make(chan authResult, 1)
+	var once sync.Once
 	go http.Serve(listener, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		code := r.FormValue("code")
-		codeCh <- code // send code to OAuth flow
-		listener.Close()
-		w.Header().Set("Content-Type", "text/plain")
-		fmt.Fprintf(w, "Received code: %v\r\nYou can now safely close this browser window.", code)
+		if r.URL.Path != path {
+			http.NotFound(w, r)
+			return
+		}
+		if subtle.ConstantTimeCompare([]byte(r.FormValue("state")), []byte(state)) != 1 {
+			writeResultPage(w, http.StatusBadRequest, "The request did not come from this authorization. Try again.")
+			return
+		}
+
+		var result authResult
+		if e := r.FormValue("error"); e != "" {
+			result.err = &oauth.Error{Code: e, Description: r.FormValue("error_description"), URI: r.FormValue("error_uri")}
+			writeResultPage(w, http.StatusOK, "The authorization server returned "+e+".")
+		} else if code := r.FormValue("code"); code == "" {
+			writeResultPage(w, http.StatusBadRequest, "No authorization code was received.")
+			return
+		} else {
+			result.code = code
+			writeResultPage(w, http.StatusOK, "")
+		}
+		once.Do(func() {
+			resultCh <- result // send code to OAuth flow
+			listener.Close()
+		})
 	}))
 
-	return codeCh, nil
+	return resultCh, redirectURL, nil
+}
+
+// authorize takes the user through the OAuth flow selected with
+// -auth-mode and returns the new token.
+// In browser mode, it opens a browser in the native OS or outputs a URL,
+// then blocks until the redirect completes to the loopback web server.
+func authorize(ctx context.Context, config *oauth2.Config) (*oauth2.Token, error) {
+	if *authMode == "device" {
+		config.Scopes = []string{DEVICE_SCOPE}
+		return oauth.DeviceAuth(ctx, config, func(verificationURI string, userCode string) {
+			log.Printf("On any device, visit %s and enter the code %s\n", verificationURI, userCode)
+			log.Println("This program will resume once authorization has been provided.")
+		})
+	}
+
+	// Start web server.
+	// This is how this program receives the authorization code
+	// when the browser redirects.
+	state := oauth2.GenerateVerifier() // Any random string will do.
+	verifier := oauth2.GenerateVerifier()
+	resultCh, redirectURL, err := startWebServer(state, config.RedirectURL)
+	if err != nil {
+		return nil, err
+	}
+	config.RedirectURL = redirectURL
+
+	// Open url in browser
+	url := config.AuthCodeURL(state, oauth2.AccessTypeOffline, oauth2.ApprovalForce, oauth2.S256ChallengeOption(verifier))
+	err = openURL(url)
+	if err != nil {
+		log.Println("Visit the URL below to get a code.",
+			" This program will pause until the site is visted.")
+		fmt.Println(url)
+	} else {
+		log.Println("Your browser has been opened to an authorization URL.",
+			" This program will resume once authorization has been provided.")
+	}
+
+	// Wait for the web server to get the code.
+	var result authResult
+	select {
+	case result = <-resultCh:
+	case <-time.After(*authTimeout):
+		return nil, fmt.Errorf("Timed out after %s waiting for authorization; run again, or use -auth-mode device", *authTimeout)
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	if result.err != nil {
+		return nil, result.err
+	}
+
+	token, err := config.Exchange(ctx, result.code, oauth2.VerifierOption(verifier))
+	return token, oauth.WrapError(err)
+}
+
+// explainAuthError adds what to do about the OAuth errors a user can fix.
+func explainAuthError(err error) error {
+	switch {
+	case oauth.IsCode(err, "invalid_client"), oauth.IsCode(err, "unauthorized_client"):
+		return fmt.Errorf("The OAuth client was rejected; check -client-secrets, or %s and %s: %w", CLIENT_ID_ENV, CLIENT_SECRET_ENV, err)
+	case oauth.IsCode(err, "access_denied"):
+		return fmt.Errorf("Authorization was denied: %w", err)
+	case oauth.IsCode(err, "expired_token"):
+		return fmt.Errorf("The device code expired before it was entered; run again: %w", err)
+	}
+	return err
 }
 
-// buildOAuthHTTPClient takes the user through the three-legged OAuth flow.
-// It opens a browser in the native OS or outputs a URL, then blocks until
-// the redirect completes to the /oauth2callback URI.
-// It returns an instance of an HTTP client that can be passed to the
-// constructor of the YouTube client.
-func buildOAuthHTTPClient(scope string) (*http.Client, error) {
+// buildOAuthHTTPClient returns an instance of an HTTP client that can be
+// passed to the constructor of the YouTube client, authorizing first if
+// there's no usable token in the cache. Token requests, including later
+// refreshes, are cancelled with ctx.
+func buildOAuthHTTPClient(ctx context.Context, scope string) (*http.Client, error) {
+	if *serviceAccount != "" {
+		return buildServiceAccountClient(ctx, scope)
+	}
+
 	config, err := buildConfig(scope)
 	if err != nil {
 		msg := fmt.Sprintf("Cannot read configuration file: %v", err)
 		return nil, errors.New(msg)
 	}
 
-	transport := &oauth.Transport{Config: config}
+	cache := tokenCache()
 
-	// Try to read the token from the cache file.
-	// If an error occurs, do the three-legged OAuth flow because
-	// the token is invalid or doesn't exist.
-	token, err := config.TokenCache.Token()
+	// Do the OAuth flow only if there's no token yet; one that can't be
+	// read, e.g. for a wrong passphrase, mustn't be overwritten.
+	token, err := cache.Token()
+	if err != nil && !oauth.IsNotFound(err) {
+		return nil, fmt.Errorf("Cannot read token cache: %v", err)
+	}
+	if err == nil {
+		// Refresh now, so a revoked authorization is found before the
+		// upload starts rather than in the middle of it. An access token
+		// stays valid for a while after the user revokes access, so only
+		// refreshing tells.
+		ts := oauth.TokenSource(ctx, config, cache, token, *expirySkew)
+		if token.RefreshToken != "" {
+			token, err = ts.(oauth.Refresher).Refresh(ctx, token)
+		} else {
+			token, err = ts.Token()
+		}
+		if oauth.IsCode(err, "invalid_grant") {
+			log.Printf("The saved authorization for account %s has been revoked or has expired; authorizing again\n", accountLabel(*account))
+		} else if err != nil {
+			return nil, explainAuthError(err)
+		}
+	}
 	if err != nil {
-		// Start web server.
-		// This is how this program receives the authorization code
-		// when the browser redirects.
-		codeCh, err := startWebServer()
+		token, err = authorize(ctx, config)
 		if err != nil {
+			return nil, explainAuthError(err)
+		}
+		if err := cache.PutToken(token); err != nil {
 			return nil, err
 		}
+	}
 
-		// Open url in browser
-		url := config.AuthCodeURL("")
-		// fmt.Println("URL=" + url)
-		err = openURL(url)
-		if err != nil {
-			log.Println("Visit the URL below to get a code.",
-				" This program will pause until the site is visted.")
-		} else {
-			log.Println("Your browser has been opened to an authorization URL.",
-				" This program will resume once authorization has been provided.")
-		}
-		// fmt.Println(url)
+	return &http.Client{Transport: &oauth.Transport{Source: oauth.TokenSource(ctx, config, cache, token, *expirySkew)}}, nil
+}
 
-		// Wait for the web server to get the code.
-		code := <-codeCh
+// buildServiceAccountClient returns an HTTP client authorized as the
+// service account given with -service-account.
+func buildServiceAccountClient(ctx context.Context, scope string) (*http.Client, error) {
+	sa, err := oauth.LoadServiceAccount(*serviceAccount)
+	if err != nil {
+		return nil, fmt.Errorf("Cannot read service account key: %v", err)
+	}
+	sa.Scopes = strings.Fields(scope)
+	sa.Subject = *impersonate
 
-		// This code caches the authorization code on the local
-		// filesystem, if necessary, as long as the TokenCache
-		// attribute in the config is set.
-		token, err = transport.Exchange(code)
-		if err != nil {
-			return nil, err
+	ts := sa.TokenSource(ctx, serviceAccountCache(sa.Email, sa.Subject), *expirySkew)
+	// Get a token now, so a key without access fails before the upload.
+	if _, err := ts.Token(); err != nil {
+		if oauth.IsCode(err, "unauthorized_client") && sa.Subject != "" {
+			return nil, fmt.Errorf("Service account %s may not impersonate %s; set up domain-wide delegation for it: %w", sa.Email, sa.Subject, err)
 		}
+		return nil, fmt.Errorf("Service account %s was not authorized: %w", sa.Email, err)
 	}
-
-	transport.Token = token
-	return transport.Client(), nil
+	return &http.Client{Transport: &oauth.Transport{Source: ts}}, nil
 }
@@ -0,0 +1,203 @@
+// Based on goauth2
+
+// Copyright 2011 The goauth2 Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package oauth persists golang.org/x/oauth2 tokens across runs.
+package oauth
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/zalando/go-keyring"
+	"golang.org/x/oauth2"
+)
+
+// Cache specifies the methods that implement a Token cache.
+type Cache interface {
+	// Token returns the cached token, or an error for which IsNotFound
+	// is true if there's none.
+	Token() (*oauth2.Token, error)
+	PutToken(*oauth2.Token) error
+
+	// Delete removes the token. It's not an error if there's none.
+	Delete() error
+}
+
+// IsNotFound reports whether err from Cache.Token means there's no token
+// yet, as opposed to one that can't be read.
+func IsNotFound(err error) bool {
+	return errors.Is(err, os.ErrNotExist) || errors.Is(err, keyring.ErrNotFound)
+}
+
+// Locker is implemented by caches that can be locked against other
+// processes, so only one of them refreshes the token at a time.
+type Locker interface {
+	Lock() (unlock func(), err error)
+}
+
+// CacheFile implements Cache. Its value is the name of the file in which
+// the Token is stored in JSON format.
+//
+// Files written by older versions, which used their own Token type, are
+// read too and rewritten in the current format.
+type CacheFile string
+
+// cachedToken is the format of a CacheFile.
+type cachedToken struct {
+	oauth2.Token
+
+	// IDToken and Scope are kept because oauth2.Token doesn't serialize
+	// its extras.
+	IDToken string `json:"id_token,omitempty"`
+	Scope   string `json:"scope,omitempty"`
+}
+
+// legacyToken is the format written by the goauth2 based package.
+type legacyToken struct {
+	AccessToken  string
+	RefreshToken string
+	Expiry       time.Time
+	Extra        map[string]string
+}
+
+func (f CacheFile) Token() (*oauth2.Token, error) {
+	data, err := ioutil.ReadFile(string(f))
+	if err != nil {
+		return nil, err
+	}
+	tok, legacy, err := unmarshalToken(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", f, err)
+	}
+	if legacy {
+		// Rewrite it in the current format.
+		if err := f.PutToken(tok); err != nil {
+			return nil, err
+		}
+	}
+	return tok, nil
+}
+
+func (f CacheFile) PutToken(tok *oauth2.Token) error {
+	data, err := marshalToken(tok)
+	if err != nil {
+		return err
+	}
+	return WriteFileAtomic(string(f), data)
+}
+
+func (f CacheFile) Delete() error {
+	return removeFile(string(f))
+}
+
+// Lock takes an exclusive lock shared by all processes using the file.
+func (f CacheFile) Lock() (unlock func(), err error) {
+	return LockFile(string(f) + ".lock")
+}
+
+// WriteFileAtomic writes data to a temporary file and renames it to path,
+// so readers never see a partially written file.
+func WriteFileAtomic(path string, data []byte) error {
+	file, err := ioutil.TempFile(filepath.Dir(path), filepath.Base(path)+".tmp")
+	if err != nil {
+		return err
+	}
+	tmp := file.Name()
+	if err := file.Chmod(0600); err != nil {
+		file.Close()
+		os.Remove(tmp)
+		return err
+	}
+	if _, err := file.Write(data); err != nil {
+		file.Close()
+		os.Remove(tmp)
+		return err
+	}
+	if err := file.Sync(); err != nil {
+		file.Close()
+		os.Remove(tmp)
+		return err
+	}
+	if err := file.Close(); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return nil
+}
+
+// removeFile removes path if it exists.
+func removeFile(path string) error {
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// marshalToken encodes tok in the cache format.
+func marshalToken(tok *oauth2.Token) ([]byte, error) {
+	ct := &cachedToken{Token: *tok}
+	if id, ok := tok.Extra("id_token").(string); ok {
+		ct.IDToken = id
+	}
+	if scope, ok := tok.Extra("scope").(string); ok {
+		ct.Scope = scope
+	}
+	data, err := json.Marshal(ct)
+	if err != nil {
+		return nil, err
+	}
+	return append(data, '\n'), nil
+}
+
+// unmarshalToken decodes a token in the cache format or the legacy one,
+// reporting which it was.
+func unmarshalToken(data []byte) (tok *oauth2.Token, legacy bool, err error) {
+	var keys map[string]json.RawMessage
+	if err := json.Unmarshal(data, &keys); err != nil {
+		return nil, false, err
+	}
+	if _, ok := keys["AccessToken"]; ok {
+		lt := &legacyToken{}
+		if err := json.Unmarshal(data, lt); err != nil {
+			return nil, false, err
+		}
+		return withExtras(&oauth2.Token{
+			AccessToken:  lt.AccessToken,
+			TokenType:    "Bearer",
+			RefreshToken: lt.RefreshToken,
+			Expiry:       lt.Expiry,
+		}, lt.Extra["id_token"], lt.Extra["scope"]), true, nil
+	}
+
+	ct := &cachedToken{}
+	if err := json.Unmarshal(data, ct); err != nil {
+		return nil, false, err
+	}
+	return withExtras(&ct.Token, ct.IDToken, ct.Scope), false, nil
+}
+
+func withExtras(tok *oauth2.Token, idToken string, scope string) *oauth2.Token {
+	extra := make(map[string]interface{})
+	if idToken != "" {
+		extra["id_token"] = idToken
+	}
+	if scope != "" {
+		extra["scope"] = scope
+	}
+	if len(extra) == 0 {
+		return tok
+	}
+	return tok.WithExtra(extra)
+}
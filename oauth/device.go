@@ -0,0 +1,75 @@
+package oauth
+
+import (
+	"context"
+	"net/url"
+	"time"
+
+	"golang.org/x/oauth2"
+)
+
+// DEVICE_CODE_GRANT is the grant type of RFC 8628 section 3.4.
+const DEVICE_CODE_GRANT = "urn:ietf:params:oauth:grant-type:device_code"
+
+// slowDownStep is how much a slow_down response adds to the polling
+// interval, per RFC 8628 section 3.5.
+const slowDownStep = 5 * time.Second
+
+// deviceSleep waits between polls of the token endpoint; tests replace it.
+var deviceSleep = func(ctx context.Context, d time.Duration) error {
+	select {
+	case <-time.After(d):
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// DeviceAuth authorizes with the device flow of RFC 8628: it gets a user
+// code, passes it to prompt along with the URL where the user enters it,
+// and waits for the user to finish with PollDeviceToken.
+func DeviceAuth(ctx context.Context, config *oauth2.Config, prompt func(verificationURI string, userCode string)) (*oauth2.Token, error) {
+	da, err := config.DeviceAuth(ctx)
+	if err != nil {
+		return nil, WrapError(err)
+	}
+	prompt(da.VerificationURI, da.UserCode)
+	return PollDeviceToken(ctx, config, da)
+}
+
+// PollDeviceToken polls the token endpoint until the user has approved or
+// denied the request, or the device code has expired. It keeps polling on
+// authorization_pending and slows down on slow_down; any other error,
+// such as access_denied or expired_token, is returned as an *Error.
+func PollDeviceToken(ctx context.Context, config *oauth2.Config, da *oauth2.DeviceAuthResponse) (*oauth2.Token, error) {
+	interval := time.Duration(da.Interval) * time.Second
+	if interval <= 0 {
+		interval = slowDownStep
+	}
+	form := url.Values{
+		"grant_type":  {DEVICE_CODE_GRANT},
+		"device_code": {da.DeviceCode},
+		"client_id":   {config.ClientID},
+	}
+	if config.ClientSecret != "" {
+		form.Set("client_secret", config.ClientSecret)
+	}
+	for {
+		if !da.Expiry.IsZero() && time.Now().After(da.Expiry) {
+			return nil, &Error{Code: "expired_token", Description: "the device code expired before it was entered"}
+		}
+		if err := deviceSleep(ctx, interval); err != nil {
+			return nil, err
+		}
+		tok, err := postToken(ctx, config.Endpoint.TokenURL, form)
+		switch {
+		case err == nil:
+			return tok, nil
+		case IsCode(err, "authorization_pending"):
+		case IsCode(err, "slow_down"):
+			interval += slowDownStep
+		default:
+			return nil, err
+		}
+	}
+}
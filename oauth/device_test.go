@@ -0,0 +1,142 @@
+package oauth
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"golang.org/x/oauth2"
+)
+
+// deviceServer is a fake authorization server that answers token requests
+// with the given responses in turn, then with the token.
+type deviceServer struct {
+	t         *testing.T
+	responses []string // "error" codes
+	polls     int
+}
+
+func (s *deviceServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	switch r.URL.Path {
+	case "/device":
+		if got := r.FormValue("client_id"); got != "client" {
+			s.t.Errorf("device request client_id = %q", got)
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"device_code":      "dev-code",
+			"user_code":        "ABCD-EFGH",
+			"verification_url": "https://example.com/device",
+			"expires_in":       1800,
+			"interval":         5,
+		})
+	case "/token":
+		for k, want := range map[string]string{
+			"grant_type":    DEVICE_CODE_GRANT,
+			"device_code":   "dev-code",
+			"client_id":     "client",
+			"client_secret": "secret",
+		} {
+			if got := r.FormValue(k); got != want {
+				s.t.Errorf("token request %s = %q, want %q", k, got, want)
+			}
+		}
+		s.polls++
+		if s.polls <= len(s.responses) {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]string{"error": s.responses[s.polls-1]})
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"access_token":  "access",
+			"token_type":    "Bearer",
+			"refresh_token": "refresh",
+			"expires_in":    3600,
+			"id_token":      "id",
+		})
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func runDeviceAuth(t *testing.T, responses ...string) (*oauth2.Token, []time.Duration, error) {
+	srv := &deviceServer{t: t, responses: responses}
+	ts := httptest.NewServer(srv)
+	defer ts.Close()
+
+	var sleeps []time.Duration
+	saved := deviceSleep
+	defer func() { deviceSleep = saved }()
+	deviceSleep = func(ctx context.Context, d time.Duration) error {
+		sleeps = append(sleeps, d)
+		return nil
+	}
+
+	config := &oauth2.Config{
+		ClientID:     "client",
+		ClientSecret: "secret",
+		Endpoint: oauth2.Endpoint{
+			DeviceAuthURL: ts.URL + "/device",
+			TokenURL:      ts.URL + "/token",
+			AuthStyle:     oauth2.AuthStyleInParams,
+		},
+	}
+	var prompted string
+	tok, err := DeviceAuth(context.Background(), config, func(verificationURI string, userCode string) {
+		prompted = verificationURI + " " + userCode
+	})
+	if want := "https://example.com/device ABCD-EFGH"; prompted != want {
+		t.Errorf("prompt got %q, want %q", prompted, want)
+	}
+	return tok, sleeps, err
+}
+
+func TestDeviceAuthPendingAndSlowDown(t *testing.T) {
+	tok, sleeps, err := runDeviceAuth(t, "authorization_pending", "slow_down", "authorization_pending")
+	if err != nil {
+		t.Fatalf("DeviceAuth: %v", err)
+	}
+	if tok.AccessToken != "access" || tok.RefreshToken != "refresh" {
+		t.Errorf("got token %+v", tok)
+	}
+	if got := tok.Extra("id_token"); got != "id" {
+		t.Errorf("id_token = %v, want id", got)
+	}
+	want := []time.Duration{5 * time.Second, 5 * time.Second, 10 * time.Second, 10 * time.Second}
+	if len(sleeps) != len(want) {
+		t.Fatalf("slept %v, want %v", sleeps, want)
+	}
+	for i := range want {
+		if sleeps[i] != want[i] {
+			t.Fatalf("slept %v, want %v", sleeps, want)
+		}
+	}
+}
+
+func TestDeviceAuthErrors(t *testing.T) {
+	for _, code := range []string{"access_denied", "expired_token"} {
+		tok, sleeps, err := runDeviceAuth(t, "authorization_pending", code)
+		if tok != nil {
+			t.Errorf("%s: got token %+v", code, tok)
+		}
+		if !IsCode(err, code) {
+			t.Errorf("%s: got error %v", code, err)
+		}
+		if len(sleeps) != 2 {
+			t.Errorf("%s: polled %d times, want 2", code, len(sleeps))
+		}
+	}
+}
+
+func TestDeviceAuthCancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	da := &oauth2.DeviceAuthResponse{DeviceCode: "dev-code", Interval: 5}
+	_, err := PollDeviceToken(ctx, &oauth2.Config{}, da)
+	if err != context.Canceled {
+		t.Errorf("got %v, want context.Canceled", err)
+	}
+}
@@ -0,0 +1,112 @@
+package oauth
+
+import (
+	"bytes"
+	"crypto/rand"
+	"errors"
+	"io"
+	"io/ioutil"
+
+	"golang.org/x/crypto/nacl/secretbox"
+	"golang.org/x/crypto/scrypt"
+	"golang.org/x/oauth2"
+)
+
+// encryptedMagic starts every EncryptedCacheFile.
+const encryptedMagic = "yt-up-secretbox-v1\n"
+
+const (
+	saltSize  = 16
+	nonceSize = 24
+)
+
+// EncryptedCacheFile implements Cache like CacheFile, but encrypts the
+// token with NaCl secretbox using a key derived from a passphrase with
+// scrypt.
+type EncryptedCacheFile struct {
+	Path string
+
+	// Passphrase returns the passphrase. It's called on each access.
+	Passphrase func() ([]byte, error)
+}
+
+var errBadPassphrase = errors.New("wrong passphrase or corrupt token cache")
+
+func deriveKey(passphrase, salt []byte) (*[32]byte, error) {
+	k, err := scrypt.Key(passphrase, salt, 1<<15, 8, 1, 32)
+	if err != nil {
+		return nil, err
+	}
+	var key [32]byte
+	copy(key[:], k)
+	return &key, nil
+}
+
+func (f EncryptedCacheFile) Token() (*oauth2.Token, error) {
+	data, err := ioutil.ReadFile(f.Path)
+	if err != nil {
+		return nil, err
+	}
+	if !bytes.HasPrefix(data, []byte(encryptedMagic)) || len(data) < len(encryptedMagic)+saltSize+nonceSize {
+		return nil, errors.New(f.Path + ": not an encrypted token cache")
+	}
+	data = data[len(encryptedMagic):]
+	salt, data := data[:saltSize], data[saltSize:]
+	var nonce [nonceSize]byte
+	copy(nonce[:], data[:nonceSize])
+	data = data[nonceSize:]
+
+	passphrase, err := f.Passphrase()
+	if err != nil {
+		return nil, err
+	}
+	key, err := deriveKey(passphrase, salt)
+	if err != nil {
+		return nil, err
+	}
+	plain, ok := secretbox.Open(nil, data, &nonce, key)
+	if !ok {
+		return nil, errBadPassphrase
+	}
+	tok, _, err := unmarshalToken(plain)
+	return tok, err
+}
+
+func (f EncryptedCacheFile) PutToken(tok *oauth2.Token) error {
+	plain, err := marshalToken(tok)
+	if err != nil {
+		return err
+	}
+	passphrase, err := f.Passphrase()
+	if err != nil {
+		return err
+	}
+
+	salt := make([]byte, saltSize)
+	var nonce [nonceSize]byte
+	if _, err := io.ReadFull(rand.Reader, salt); err != nil {
+		return err
+	}
+	if _, err := io.ReadFull(rand.Reader, nonce[:]); err != nil {
+		return err
+	}
+	key, err := deriveKey(passphrase, salt)
+	if err != nil {
+		return err
+	}
+
+	out := []byte(encryptedMagic)
+	out = append(out, salt...)
+	out = append(out, nonce[:]...)
+	out = secretbox.Seal(out, plain, &nonce, key)
+	return WriteFileAtomic(f.Path, out)
+}
+
+func (f EncryptedCacheFile) Delete() error {
+	return removeFile(f.Path)
+}
+
+// Lock takes an exclusive lock shared by all processes using the file.
+func (f EncryptedCacheFile) Lock() (unlock func(), err error) {
+	return LockFile(f.Path + ".lock")
+}
@@ -0,0 +1,116 @@
+package oauth
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"mime"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"golang.org/x/oauth2"
+)
+
+// Error is an error response from an OAuth 2.0 endpoint, as described in
+// RFC 6749 section 5.2. Use errors.As to find it and branch on Code, e.g.
+// "invalid_grant" when a refresh token has been revoked or has expired,
+// "invalid_client" or "access_denied".
+type Error struct {
+	// Status is the HTTP status code, or 0 if the error came in a
+	// redirect rather than a response.
+	Status int
+
+	Code        string // "error"
+	Description string // "error_description"
+	URI         string // "error_uri"
+
+	// Body is the response body, for responses that aren't in either
+	// format.
+	Body []byte
+
+	// Err is the underlying error, if any, such as an *oauth2.RetrieveError.
+	Err error
+}
+
+func (e *Error) Error() string {
+	var b strings.Builder
+	b.WriteString("oauth: ")
+	switch {
+	case e.Code != "":
+		b.WriteString(e.Code)
+		if e.Description != "" {
+			b.WriteString(": " + e.Description)
+		}
+	case len(e.Body) > 0:
+		b.WriteString(strings.TrimSpace(string(e.Body)))
+	default:
+		b.WriteString("request failed")
+	}
+	if e.Status != 0 {
+		fmt.Fprintf(&b, " (HTTP %d)", e.Status)
+	}
+	if e.URI != "" {
+		b.WriteString("; see " + e.URI)
+	}
+	return b.String()
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// ParseError returns the error in a non-2xx response from an OAuth
+// endpoint, whose body has already been read. The body may be JSON or
+// form encoded.
+func ParseError(res *http.Response, body []byte) *Error {
+	e := &Error{Status: res.StatusCode}
+	ct, _, _ := mime.ParseMediaType(res.Header.Get("Content-Type"))
+	switch ct {
+	case "application/x-www-form-urlencoded", "text/plain":
+		if vals, err := url.ParseQuery(string(body)); err == nil && vals.Get("error") != "" {
+			e.Code = vals.Get("error")
+			e.Description = vals.Get("error_description")
+			e.URI = vals.Get("error_uri")
+			return e
+		}
+	}
+	var fields struct {
+		Code        string `json:"error"`
+		Description string `json:"error_description"`
+		URI         string `json:"error_uri"`
+	}
+	if json.Unmarshal(body, &fields) == nil && fields.Code != "" {
+		e.Code, e.Description, e.URI = fields.Code, fields.Description, fields.URI
+		return e
+	}
+	e.Body = body
+	return e
+}
+
+// WrapError returns err as an *Error if it's an *oauth2.RetrieveError,
+// and err unchanged otherwise.
+func WrapError(err error) error {
+	var rerr *oauth2.RetrieveError
+	if !errors.As(err, &rerr) {
+		return err
+	}
+	var e *Error
+	if rerr.Response != nil {
+		e = ParseError(rerr.Response, rerr.Body)
+	} else {
+		e = &Error{Body: rerr.Body}
+	}
+	if e.Code == "" && rerr.ErrorCode != "" {
+		e.Code, e.Description, e.URI = rerr.ErrorCode, rerr.ErrorDescription, rerr.ErrorURI
+		e.Body = nil
+	}
+	e.Err = err
+	return e
+}
+
+// IsCode reports whether err is an *Error with the given code.
+func IsCode(err error, code string) bool {
+	var e *Error
+	return errors.As(err, &e) && e.Code == code
+}
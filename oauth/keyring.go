@@ -0,0 +1,46 @@
+package oauth
+
+import (
+	"errors"
+
+	"github.com/zalando/go-keyring"
+	"golang.org/x/oauth2"
+)
+
+// KeyringCache implements Cache by storing the token in the OS keyring:
+// the Secret Service over D-Bus on Linux, the Keychain on macOS and the
+// Credential Manager on Windows.
+type KeyringCache struct {
+	Service string
+	User    string
+}
+
+func (k KeyringCache) Token() (*oauth2.Token, error) {
+	secret, err := keyring.Get(k.Service, k.User)
+	if err != nil {
+		return nil, err
+	}
+	tok, _, err := unmarshalToken([]byte(secret))
+	return tok, err
+}
+
+func (k KeyringCache) PutToken(tok *oauth2.Token) error {
+	data, err := marshalToken(tok)
+	if err != nil {
+		return err
+	}
+	return keyring.Set(k.Service, k.User, string(data))
+}
+
+func (k KeyringCache) Delete() error {
+	if err := keyring.Delete(k.Service, k.User); err != nil && !errors.Is(err, keyring.ErrNotFound) {
+		return err
+	}
+	return nil
+}
+
+// KeyringAvailable reports whether there's a keyring to store tokens in.
+func KeyringAvailable() bool {
+	_, err := keyring.Get("yt-up", "keyring-probe")
+	return err == nil || errors.Is(err, keyring.ErrNotFound)
+}
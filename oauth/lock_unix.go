@@ -0,0 +1,25 @@
+//go:build !windows
+
+package oauth
+
+import (
+	"os"
+	"syscall"
+)
+
+// LockFile takes an exclusive advisory lock on path, creating it if needed.
+// It blocks until the lock is free.
+func LockFile(path string) (unlock func(), err error) {
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, err
+	}
+	if err := syscall.Flock(int(file.Fd()), syscall.LOCK_EX); err != nil {
+		file.Close()
+		return nil, err
+	}
+	return func() {
+		syscall.Flock(int(file.Fd()), syscall.LOCK_UN)
+		file.Close()
+	}, nil
+}
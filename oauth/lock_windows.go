@@ -0,0 +1,10 @@
+//go:build windows
+
+package oauth
+
+// LockFile doesn't lock on Windows. Files written with WriteFileAtomic
+// still can't be corrupted by concurrent writers, though an update may be
+// lost.
+func LockFile(path string) (unlock func(), err error) {
+	return func() {}, nil
+}
@@ -0,0 +1,39 @@
+package oauth
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"golang.org/x/oauth2"
+)
+
+// Revoke revokes tok at revokeURL, as described in RFC 7009. The refresh
+// token is revoked if there's one, which revokes its access tokens too.
+func Revoke(ctx context.Context, revokeURL string, tok *oauth2.Token) error {
+	t := tok.RefreshToken
+	if t == "" {
+		t = tok.AccessToken
+	}
+	if t == "" {
+		return fmt.Errorf("oauth: no token to revoke")
+	}
+	req, err := http.NewRequest("POST", revokeURL, strings.NewReader(url.Values{"token": {t}}.Encode()))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	res, err := http.DefaultClient.Do(req.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	body, _ := ioutil.ReadAll(res.Body)
+	if res.StatusCode != http.StatusOK {
+		return ParseError(res, body)
+	}
+	return nil
+}
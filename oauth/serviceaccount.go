@@ -0,0 +1,174 @@
+package oauth
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"strings"
+	"time"
+
+	"golang.org/x/oauth2"
+)
+
+// JWT_BEARER_GRANT is the grant type of RFC 7523 section 2.1.
+const JWT_BEARER_GRANT = "urn:ietf:params:oauth:grant-type:jwt-bearer"
+
+// assertionLifetime is how long a signed assertion is good for; Google
+// allows at most an hour.
+const assertionLifetime = time.Hour
+
+// ServiceAccount gets tokens for a service account with the JWT bearer
+// grant of RFC 7523, without user interaction.
+type ServiceAccount struct {
+	Email      string
+	PrivateKey *rsa.PrivateKey
+	KeyID      string
+
+	// TokenURL is the token endpoint, which is also the audience of the
+	// assertion.
+	TokenURL string
+	Scopes   []string
+
+	// Subject is the user to impersonate, if any, which needs domain-wide
+	// delegation for the service account.
+	Subject string
+}
+
+// serviceAccountKey is the format of a service account key file from the
+// Google Cloud console.
+type serviceAccountKey struct {
+	Type         string `json:"type"`
+	ClientEmail  string `json:"client_email"`
+	PrivateKey   string `json:"private_key"`
+	PrivateKeyID string `json:"private_key_id"`
+	TokenURI     string `json:"token_uri"`
+}
+
+// LoadServiceAccount reads a service account key JSON file.
+func LoadServiceAccount(path string) (*ServiceAccount, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var key serviceAccountKey
+	if err := json.Unmarshal(data, &key); err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	if key.Type != "service_account" {
+		return nil, fmt.Errorf("%s: not a service account key", path)
+	}
+	var missing []string
+	for _, f := range []struct{ name, value string }{
+		{"client_email", key.ClientEmail},
+		{"private_key", key.PrivateKey},
+		{"token_uri", key.TokenURI},
+	} {
+		if f.value == "" {
+			missing = append(missing, f.name)
+		}
+	}
+	if len(missing) > 0 {
+		return nil, fmt.Errorf("%s is missing %s", path, strings.Join(missing, ", "))
+	}
+	pk, err := parsePrivateKey([]byte(key.PrivateKey))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	return &ServiceAccount{
+		Email:      key.ClientEmail,
+		PrivateKey: pk,
+		KeyID:      key.PrivateKeyID,
+		TokenURL:   key.TokenURI,
+	}, nil
+}
+
+// parsePrivateKey parses a PEM encoded RSA key in PKCS #8 or PKCS #1 form.
+func parsePrivateKey(data []byte) (*rsa.PrivateKey, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("private_key is not PEM encoded")
+	}
+	if key, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("private_key: %v", err)
+	}
+	rsaKey, ok := key.(*rsa.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("private_key is not an RSA key")
+	}
+	return rsaKey, nil
+}
+
+// assertion returns a signed RS256 JWT asserting the service account's
+// identity to the token endpoint.
+func (sa *ServiceAccount) assertion(now time.Time) (string, error) {
+	header := map[string]string{"alg": "RS256", "typ": "JWT"}
+	if sa.KeyID != "" {
+		header["kid"] = sa.KeyID
+	}
+	claims := map[string]interface{}{
+		"iss":   sa.Email,
+		"scope": strings.Join(sa.Scopes, " "),
+		"aud":   sa.TokenURL,
+		"iat":   now.Unix(),
+		"exp":   now.Add(assertionLifetime).Unix(),
+	}
+	if sa.Subject != "" {
+		claims["sub"] = sa.Subject
+	}
+
+	var parts []string
+	for _, v := range []interface{}{header, claims} {
+		data, err := json.Marshal(v)
+		if err != nil {
+			return "", err
+		}
+		parts = append(parts, base64.RawURLEncoding.EncodeToString(data))
+	}
+	signingInput := strings.Join(parts, ".")
+	sum := sha256.Sum256([]byte(signingInput))
+	sig, err := rsa.SignPKCS1v15(rand.Reader, sa.PrivateKey, crypto.SHA256, sum[:])
+	if err != nil {
+		return "", err
+	}
+	return signingInput + "." + base64.RawURLEncoding.EncodeToString(sig), nil
+}
+
+// Token exchanges a new assertion for an access token at TokenURL.
+func (sa *ServiceAccount) Token(ctx context.Context) (*oauth2.Token, error) {
+	now := time.Now()
+	assertion, err := sa.assertion(now)
+	if err != nil {
+		return nil, err
+	}
+	form := url.Values{"grant_type": {JWT_BEARER_GRANT}, "assertion": {assertion}}
+	return postToken(ctx, sa.TokenURL, form)
+}
+
+// TokenSource returns a TokenSource that starts with the token in cache,
+// if any, and gets a new one with a fresh assertion when it expires,
+// saving it to cache.
+func (sa *ServiceAccount) TokenSource(ctx context.Context, cache Cache, skew time.Duration) oauth2.TokenSource {
+	tok, _ := cache.Token()
+	return &cachingTokenSource{
+		ctx: ctx,
+		refresh: func(ctx context.Context, old *oauth2.Token) (*oauth2.Token, error) {
+			return sa.Token(ctx)
+		},
+		cache: cache,
+		skew:  skew,
+		tok:   tok,
+	}
+}
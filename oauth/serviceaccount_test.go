@@ -0,0 +1,143 @@
+package oauth
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// checkAssertion verifies the signature of a JWT assertion with key and
+// returns its header and claims.
+func checkAssertion(t *testing.T, key *rsa.PublicKey, assertion string) (header map[string]interface{}, claims map[string]interface{}) {
+	parts := strings.Split(assertion, ".")
+	if len(parts) != 3 {
+		t.Fatalf("assertion has %d parts", len(parts))
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		t.Fatalf("signature: %v", err)
+	}
+	sum := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	if err := rsa.VerifyPKCS1v15(key, crypto.SHA256, sum[:], sig); err != nil {
+		t.Errorf("bad signature: %v", err)
+	}
+	for i, v := range []*map[string]interface{}{&header, &claims} {
+		data, err := base64.RawURLEncoding.DecodeString(parts[i])
+		if err != nil {
+			t.Fatalf("part %d: %v", i, err)
+		}
+		if err := json.Unmarshal(data, v); err != nil {
+			t.Fatalf("part %d: %v", i, err)
+		}
+	}
+	return header, claims
+}
+
+func TestServiceAccountToken(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	requests := 0
+	var tokenURL string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if got := r.FormValue("grant_type"); got != JWT_BEARER_GRANT {
+			t.Errorf("grant_type = %q", got)
+		}
+		header, claims := checkAssertion(t, &key.PublicKey, r.FormValue("assertion"))
+		if header["alg"] != "RS256" || header["kid"] != "key1" {
+			t.Errorf("header = %v", header)
+		}
+		for k, want := range map[string]string{
+			"iss":   "sa@example.iam.gserviceaccount.com",
+			"scope": "scope1 scope2",
+			"aud":   tokenURL,
+			"sub":   "user@example.com",
+		} {
+			if claims[k] != want {
+				t.Errorf("claim %s = %v, want %q", k, claims[k], want)
+			}
+		}
+		iat, _ := claims["iat"].(float64)
+		exp, _ := claims["exp"].(float64)
+		if exp-iat != assertionLifetime.Seconds() {
+			t.Errorf("iat = %v, exp = %v", iat, exp)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"access_token": "access",
+			"token_type":   "Bearer",
+			"expires_in":   3600,
+			"scope":        "scope1 scope2",
+		})
+	}))
+	defer ts.Close()
+	tokenURL = ts.URL + "/token"
+
+	sa := &ServiceAccount{
+		Email:      "sa@example.iam.gserviceaccount.com",
+		PrivateKey: key,
+		KeyID:      "key1",
+		TokenURL:   tokenURL,
+		Scopes:     []string{"scope1", "scope2"},
+		Subject:    "user@example.com",
+	}
+	cache := CacheFile(filepath.Join(t.TempDir(), "cache"))
+	src := sa.TokenSource(context.Background(), cache, DefaultExpirySkew)
+	for i := 0; i < 2; i++ {
+		tok, err := src.Token()
+		if err != nil {
+			t.Fatalf("Token: %v", err)
+		}
+		if tok.AccessToken != "access" || tok.TokenType != "Bearer" || tok.Expiry.IsZero() {
+			t.Errorf("got token %+v", tok)
+		}
+		if got := tok.Extra("scope"); got != "scope1 scope2" {
+			t.Errorf("scope = %v", got)
+		}
+	}
+	if requests != 1 {
+		t.Errorf("%d token requests, want 1", requests)
+	}
+	cached, err := cache.Token()
+	if err != nil {
+		t.Fatalf("cache: %v", err)
+	}
+	if cached.AccessToken != "access" {
+		t.Errorf("cached token %+v", cached)
+	}
+}
+
+func TestServiceAccountTokenError(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(`{"error":"unauthorized_client","error_description":"Client is unauthorized to retrieve access tokens"}`))
+	}))
+	defer ts.Close()
+
+	sa := &ServiceAccount{Email: "sa@example.com", PrivateKey: key, TokenURL: ts.URL}
+	_, err = sa.Token(context.Background())
+	var oerr *Error
+	if !errors.As(err, &oerr) {
+		t.Fatalf("got %v, want *Error", err)
+	}
+	if oerr.Status != http.StatusBadRequest || oerr.Code != "unauthorized_client" || oerr.Description == "" {
+		t.Errorf("got %+v", oerr)
+	}
+}
@@ -0,0 +1,62 @@
+package oauth
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"golang.org/x/oauth2"
+)
+
+// postToken sends a token request with the given form to tokenURL and
+// returns the token in the response, as described in RFC 6749 section 5.
+// An error response is returned as an *Error.
+func postToken(ctx context.Context, tokenURL string, form url.Values) (*oauth2.Token, error) {
+	now := time.Now()
+	req, err := http.NewRequest("POST", tokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	res, err := http.DefaultClient.Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	body, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return nil, err
+	}
+	if res.StatusCode != http.StatusOK {
+		return nil, ParseError(res, body)
+	}
+
+	var fields struct {
+		AccessToken  string `json:"access_token"`
+		TokenType    string `json:"token_type"`
+		RefreshToken string `json:"refresh_token"`
+		ExpiresIn    int64  `json:"expires_in"`
+		Scope        string `json:"scope"`
+		IDToken      string `json:"id_token"`
+	}
+	if err := json.Unmarshal(body, &fields); err != nil {
+		return nil, fmt.Errorf("oauth: cannot parse token response: %v", err)
+	}
+	if fields.AccessToken == "" {
+		return nil, fmt.Errorf("oauth: token response has no access_token")
+	}
+	tok := &oauth2.Token{
+		AccessToken:  fields.AccessToken,
+		TokenType:    fields.TokenType,
+		RefreshToken: fields.RefreshToken,
+	}
+	if fields.ExpiresIn > 0 {
+		tok.Expiry = now.Add(time.Duration(fields.ExpiresIn) * time.Second)
+	}
+	return withExtras(tok, fields.IDToken, fields.Scope), nil
+}
@@ -0,0 +1,148 @@
+package oauth
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"golang.org/x/oauth2"
+)
+
+// DefaultExpirySkew is the usual expiry skew for TokenSource: how long
+// before its Expiry a token is treated as expired, to allow for clock skew
+// and for requests that take a while to arrive.
+const DefaultExpirySkew = time.Minute
+
+// ContextTokenSource is implemented by token sources that can get a token
+// within a given context, e.g. that of the request it's for, rather than
+// the one they were made with.
+type ContextTokenSource interface {
+	TokenContext(ctx context.Context) (*oauth2.Token, error)
+}
+
+// Refresher is implemented by token sources that can be made to get a new
+// token before the one they have expires, e.g. when the server rejects it.
+type Refresher interface {
+	// Refresh returns a token other than bad, refreshing within ctx if
+	// needed.
+	Refresh(ctx context.Context, bad *oauth2.Token) (*oauth2.Token, error)
+}
+
+// cachingTokenSource gets a new token with refresh when it expires, and
+// saves new tokens to cache. ctx is used by Token, which has none of its
+// own.
+type cachingTokenSource struct {
+	ctx     context.Context
+	refresh func(ctx context.Context, old *oauth2.Token) (*oauth2.Token, error)
+	cache   Cache
+	skew    time.Duration
+
+	// mu guards tok.
+	mu  sync.Mutex
+	tok *oauth2.Token
+}
+
+// TokenSource returns a TokenSource that starts with tok, refreshes it
+// with config when it's within skew of expiring, and saves refreshed
+// tokens to cache. It implements ContextTokenSource and Refresher; Token
+// refreshes within ctx.
+// Errors from the token endpoint are reported as an *Error.
+//
+// If cache is a Locker, refreshing is done under its lock, and a token
+// another process has just refreshed is used instead of refreshing again.
+func TokenSource(ctx context.Context, config *oauth2.Config, cache Cache, tok *oauth2.Token, skew time.Duration) oauth2.TokenSource {
+	return &cachingTokenSource{
+		ctx: ctx,
+		refresh: func(ctx context.Context, old *oauth2.Token) (*oauth2.Token, error) {
+			// Only the refresh token is passed, as config's token source
+			// would return old itself if it's still valid by its own
+			// standard.
+			return config.TokenSource(ctx, &oauth2.Token{RefreshToken: old.RefreshToken}).Token()
+		},
+		cache: cache,
+		skew:  skew,
+		tok:   tok,
+	}
+}
+
+// valid reports whether tok can be used for at least s.skew more.
+func (s *cachingTokenSource) valid(tok *oauth2.Token) bool {
+	if tok == nil || tok.AccessToken == "" {
+		return false
+	}
+	return tok.Expiry.IsZero() || time.Now().Add(s.skew).Before(tok.Expiry)
+}
+
+func (s *cachingTokenSource) Token() (*oauth2.Token, error) {
+	return s.TokenContext(s.ctx)
+}
+
+func (s *cachingTokenSource) TokenContext(ctx context.Context) (*oauth2.Token, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.valid(s.tok) {
+		return s.tok, nil
+	}
+	return s.refreshLocked(ctx, s.tok)
+}
+
+func (s *cachingTokenSource) Refresh(ctx context.Context, bad *oauth2.Token) (*oauth2.Token, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// Another request may have refreshed it already.
+	if s.valid(s.tok) && (bad == nil || s.tok.AccessToken != bad.AccessToken) {
+		return s.tok, nil
+	}
+	return s.refreshLocked(ctx, bad)
+}
+
+// refreshLocked gets a token other than bad. s.mu must be held.
+func (s *cachingTokenSource) refreshLocked(ctx context.Context, bad *oauth2.Token) (*oauth2.Token, error) {
+	if l, ok := s.cache.(Locker); ok {
+		unlock, err := l.Lock()
+		if err != nil {
+			return nil, err
+		}
+		defer unlock()
+
+		cached, err := s.cache.Token()
+		if err == nil && s.valid(cached) && (bad == nil || cached.AccessToken != bad.AccessToken) {
+			s.tok = cached
+			return cached, nil
+		}
+	}
+
+	old := s.tok
+	if old == nil {
+		old = &oauth2.Token{}
+	}
+	tok, err := s.refresh(ctx, old)
+	if err != nil {
+		return nil, WrapError(err)
+	}
+	tok = keepExtras(tok, old)
+	s.tok = tok
+	if err := s.cache.PutToken(tok); err != nil {
+		return nil, err
+	}
+	return tok, nil
+}
+
+// keepExtras returns tok with the id_token and scope of old where tok has
+// none; refresh responses needn't repeat them.
+func keepExtras(tok *oauth2.Token, old *oauth2.Token) *oauth2.Token {
+	idToken, _ := tok.Extra("id_token").(string)
+	scope, _ := tok.Extra("scope").(string)
+	if idToken != "" && scope != "" {
+		return tok
+	}
+	if idToken == "" {
+		idToken, _ = old.Extra("id_token").(string)
+	}
+	if scope == "" {
+		scope, _ = old.Extra("scope").(string)
+	}
+	return withExtras(tok, idToken, scope)
+}
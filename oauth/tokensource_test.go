@@ -0,0 +1,124 @@
+package oauth
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"golang.org/x/oauth2"
+)
+
+func TestRefreshKeepsExtras(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if got := r.FormValue("refresh_token"); got != "refresh" {
+			t.Errorf("refresh_token = %q", got)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"access_token": "new",
+			"token_type":   "Bearer",
+			"expires_in":   3600,
+		})
+	}))
+	defer ts.Close()
+
+	config := &oauth2.Config{ClientID: "client", Endpoint: oauth2.Endpoint{TokenURL: ts.URL}}
+	cache := CacheFile(filepath.Join(t.TempDir(), "cache"))
+	old := withExtras(&oauth2.Token{
+		AccessToken:  "old",
+		RefreshToken: "refresh",
+		Expiry:       time.Now().Add(time.Hour),
+	}, "id", "scope1")
+	if err := cache.PutToken(old); err != nil {
+		t.Fatal(err)
+	}
+
+	tok, err := TokenSource(context.Background(), config, cache, old, DefaultExpirySkew).(Refresher).Refresh(context.Background(), old)
+	if err != nil {
+		t.Fatalf("Refresh: %v", err)
+	}
+	if tok.AccessToken != "new" || tok.RefreshToken != "refresh" {
+		t.Errorf("got token %+v", tok)
+	}
+	cached, err := cache.Token()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, got := range []*oauth2.Token{tok, cached} {
+		if got.Extra("id_token") != "id" || got.Extra("scope") != "scope1" {
+			t.Errorf("extras not kept: id_token=%v scope=%v", got.Extra("id_token"), got.Extra("scope"))
+		}
+	}
+	if cached.AccessToken != "new" {
+		t.Errorf("cached access token = %q, want new", cached.AccessToken)
+	}
+}
+
+func TestTokenSourceSkew(t *testing.T) {
+	refreshes := 0
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		refreshes++
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{"access_token": "new", "expires_in": 3600})
+	}))
+	defer ts.Close()
+
+	config := &oauth2.Config{ClientID: "client", Endpoint: oauth2.Endpoint{TokenURL: ts.URL}}
+	for _, test := range []struct {
+		skew time.Duration
+		want string
+	}{
+		{0, "old"},
+		{time.Minute, "new"},
+	} {
+		cache := CacheFile(filepath.Join(t.TempDir(), "cache"))
+		old := &oauth2.Token{AccessToken: "old", RefreshToken: "refresh", Expiry: time.Now().Add(30 * time.Second)}
+		tok, err := TokenSource(context.Background(), config, cache, old, test.skew).Token()
+		if err != nil {
+			t.Fatalf("skew %s: %v", test.skew, err)
+		}
+		if tok.AccessToken != test.want {
+			t.Errorf("skew %s: got %q, want %q", test.skew, tok.AccessToken, test.want)
+		}
+	}
+	if refreshes != 1 {
+		t.Errorf("%d refreshes, want 1", refreshes)
+	}
+}
+
+func TestTransportRefreshesWithinRequestContext(t *testing.T) {
+	done := make(chan struct{})
+	tokenServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Hang until the test is over.
+		<-done
+	}))
+	defer tokenServer.Close()
+	defer close(done)
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Errorf("request sent without a token")
+	}))
+	defer api.Close()
+
+	config := &oauth2.Config{ClientID: "client", Endpoint: oauth2.Endpoint{TokenURL: tokenServer.URL}}
+	cache := CacheFile(filepath.Join(t.TempDir(), "cache"))
+	expired := &oauth2.Token{AccessToken: "old", RefreshToken: "refresh", Expiry: time.Now().Add(-time.Hour)}
+	client := &http.Client{Transport: &Transport{Source: TokenSource(context.Background(), config, cache, expired, DefaultExpirySkew)}}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, "GET", api.URL, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	start := time.Now()
+	if _, err := client.Do(req); err == nil {
+		t.Fatalf("request succeeded")
+	}
+	if d := time.Since(start); d > 5*time.Second {
+		t.Errorf("the refresh took %s, ignoring the request's deadline", d)
+	}
+}
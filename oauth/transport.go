@@ -0,0 +1,89 @@
+package oauth
+
+import (
+	"net/http"
+	"regexp"
+
+	"golang.org/x/oauth2"
+)
+
+// invalidTokenRe matches a WWW-Authenticate header rejecting a bearer
+// token, as described in RFC 6750 section 3.
+var invalidTokenRe = regexp.MustCompile(`(?i)^\s*bearer\b.*\berror\s*=\s*"?invalid_token\b`)
+
+// Transport is an http.RoundTripper that authorizes requests with tokens
+// from Source. If Source is a ContextTokenSource, tokens are fetched within
+// the request's context, so its deadline bounds the token endpoint call.
+//
+// If the server rejects a token before it expires, e.g. because it was
+// revoked or the clock is off, and Source is a Refresher, the token is
+// refreshed and the request sent once more, provided its body can be
+// rewound with GetBody.
+type Transport struct {
+	Source oauth2.TokenSource
+
+	// Base is the transport that sends the requests; nil means
+	// http.DefaultTransport.
+	Base http.RoundTripper
+}
+
+func (t *Transport) base() http.RoundTripper {
+	if t.Base != nil {
+		return t.Base
+	}
+	return http.DefaultTransport
+}
+
+func (t *Transport) token(req *http.Request) (*oauth2.Token, error) {
+	if cs, ok := t.Source.(ContextTokenSource); ok {
+		return cs.TokenContext(req.Context())
+	}
+	return t.Source.Token()
+}
+
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	tok, err := t.token(req)
+	if err != nil {
+		closeBody(req)
+		return nil, err
+	}
+	res, err := t.base().RoundTrip(authorize(req, tok))
+	if err != nil || res.StatusCode != http.StatusUnauthorized || !invalidTokenRe.MatchString(res.Header.Get("WWW-Authenticate")) {
+		return res, err
+	}
+
+	refresher, ok := t.Source.(Refresher)
+	if !ok || (req.Body != nil && req.Body != http.NoBody && req.GetBody == nil) {
+		return res, nil
+	}
+	newTok, err := refresher.Refresh(req.Context(), tok)
+	if err != nil {
+		res.Body.Close()
+		return nil, err
+	}
+
+	retry := authorize(req, newTok)
+	if req.GetBody != nil {
+		body, err := req.GetBody()
+		if err != nil {
+			return res, nil
+		}
+		retry.Body = body
+	}
+	res.Body.Close()
+	return t.base().RoundTrip(retry)
+}
+
+// authorize returns a copy of req with tok in the Authorization header;
+// RoundTrippers mustn't change the request they're given.
+func authorize(req *http.Request, tok *oauth2.Token) *http.Request {
+	r := req.Clone(req.Context())
+	tok.SetAuthHeader(r)
+	return r
+}
+
+func closeBody(req *http.Request) {
+	if req.Body != nil {
+		req.Body.Close()
+	}
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	publishAt = flag.String("publish-at", "", "Upload as private and publish at this time: RFC 3339, \"+2d\", \"+90m\", \"tomorrow 09:00\", \"2006-01-02 15:04\"")
+	timezone  = flag.String("timezone", "Local", "Time zone for -publish-at times without an offset, e.g. America/Los_Angeles")
+)
+
+var relativeRe = regexp.MustCompile(`^\+(?:(\d+)d)?(.*)$`)
+
+// parsePublishAt parses the -publish-at forms relative to now. Times
+// without an explicit offset are in loc.
+func parsePublishAt(s string, now time.Time, loc *time.Location) (time.Time, error) {
+	s = strings.TrimSpace(s)
+
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, nil
+	}
+
+	if m := relativeRe.FindStringSubmatch(s); m != nil {
+		var d time.Duration
+		if m[1] != "" {
+			days, _ := strconv.Atoi(m[1])
+			d = time.Duration(days) * 24 * time.Hour
+		}
+		if m[2] != "" {
+			rest, err := time.ParseDuration(m[2])
+			if err != nil {
+				return time.Time{}, fmt.Errorf("Bad relative time %q", s)
+			}
+			d += rest
+		}
+		if m[1] == "" && m[2] == "" {
+			return time.Time{}, fmt.Errorf("Bad relative time %q", s)
+		}
+		return now.In(loc).Add(d), nil
+	}
+
+	now = now.In(loc)
+	fields := strings.Fields(s)
+	if len(fields) == 2 {
+		var day time.Time
+		switch strings.ToLower(fields[0]) {
+		case "today":
+			day = now
+		case "tomorrow":
+			day = now.AddDate(0, 0, 1)
+		}
+		if !day.IsZero() {
+			clock, err := time.Parse("15:04", fields[1])
+			if err != nil {
+				return time.Time{}, fmt.Errorf("Bad time of day %q", fields[1])
+			}
+			return time.Date(day.Year(), day.Month(), day.Day(), clock.Hour(), clock.Minute(), 0, 0, loc), nil
+		}
+	}
+
+	for _, layout := range []string{"2006-01-02 15:04", "2006-01-02T15:04", "2006-01-02 15:04:05", "2006-01-02T15:04:05"} {
+		if t, err := time.ParseInLocation(layout, s, loc); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("Unrecognized time %q", s)
+}
+
+// publishTime returns the time given by -publish-at, or the zero time if
+// it's not given.
+func publishTime() (time.Time, error) {
+	if *publishAt == "" {
+		return time.Time{}, nil
+	}
+	loc, err := time.LoadLocation(*timezone)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("Bad -timezone: %v", err)
+	}
+	now := time.Now()
+	t, err := parsePublishAt(*publishAt, now, loc)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if !t.After(now) {
+		return time.Time{}, fmt.Errorf("Publish time %s is in the past", formatPublishTime(t))
+	}
+	return t, nil
+}
+
+func formatPublishTime(t time.Time) string {
+	return t.Format("2006-01-02 15:04 MST")
+}
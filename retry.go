@@ -0,0 +1,170 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"math/rand"
+	"net"
+	"net/url"
+	"strconv"
+	"time"
+
+	"google.golang.org/api/googleapi"
+)
+
+var (
+	retries       = flag.Int("retries", 8, "Max attempts for each API call or upload chunk")
+	retryDelay    = flag.Duration("retry-delay", time.Second, "Delay before the first retry; doubled on each attempt")
+	retryMaxDelay = flag.Duration("retry-max-delay", 2*time.Minute, "Max delay between retries")
+	retryJitter   = flag.Float64("retry-jitter", 0.5, "Fraction of each retry delay to randomize (0-1)")
+)
+
+// retryPolicy decides whether and when a failed call is tried again.
+type retryPolicy struct {
+	maxAttempts int
+	baseDelay   time.Duration
+	maxDelay    time.Duration
+	jitter      float64
+}
+
+func newRetryPolicy() *retryPolicy {
+	return &retryPolicy{
+		maxAttempts: *retries,
+		baseDelay:   *retryDelay,
+		maxDelay:    *retryMaxDelay,
+		jitter:      *retryJitter,
+	}
+}
+
+// checkRetryFlags validates the retry flags.
+func checkRetryFlags() error {
+	if *retryJitter < 0 || *retryJitter > 1 {
+		return fmt.Errorf("-retry-jitter must be between 0 and 1, got %v", *retryJitter)
+	}
+	return nil
+}
+
+// do calls f until it succeeds, it returns an error that isn't retryable,
+// the attempts run out or ctx is done. what describes the call in the log.
+func (p *retryPolicy) do(ctx context.Context, what string, f func() error) error {
+	for attempt := 1; ; attempt++ {
+		err := f()
+		if err == nil {
+			return nil
+		}
+		if ctx.Err() != nil {
+			return err
+		}
+		if !isRetryable(err) {
+			log.Printf("%s failed, not retrying: %v", what, err)
+			return err
+		}
+		if attempt >= p.maxAttempts {
+			log.Printf("%s failed, giving up after %d attempts: %v", what, attempt, err)
+			return err
+		}
+		delay := p.delay(attempt, err)
+		log.Printf("%s failed, retrying in %s (attempt %d/%d): %v", what, delay, attempt+1, p.maxAttempts, err)
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+			return err
+		}
+	}
+}
+
+// doInsert is like do for calls that create something. A failed insert may
+// have taken effect on the server anyway, so before each retry exists is
+// asked whether it did; blindly retrying could create duplicates. With
+// checkFirst, it's asked before the first attempt too, for inserts an
+// earlier run may have done.
+func (p *retryPolicy) doInsert(ctx context.Context, what string, checkFirst bool, exists func() (bool, error), insert func() error) error {
+	retrying := checkFirst
+	return p.do(ctx, what, func() error {
+		if retrying {
+			found, err := exists()
+			if err != nil {
+				return err
+			}
+			if found {
+				log.Printf("%s: already done", what)
+				return nil
+			}
+		}
+		retrying = true
+		return insert()
+	})
+}
+
+// delay returns how long to wait after the given attempt failed.
+func (p *retryPolicy) delay(attempt int, err error) time.Duration {
+	if d := retryAfter(err); d > 0 {
+		if d > p.maxDelay {
+			d = p.maxDelay
+		}
+		return d
+	}
+	d := p.baseDelay
+	for i := 1; i < attempt && d < p.maxDelay; i++ {
+		d *= 2
+	}
+	if d > p.maxDelay {
+		d = p.maxDelay
+	}
+	if p.jitter > 0 {
+		d -= time.Duration(rand.Float64() * p.jitter * float64(d))
+	}
+	return d
+}
+
+// retryAfter returns the delay requested by the server, if any.
+func retryAfter(err error) time.Duration {
+	var gerr *googleapi.Error
+	if !errors.As(err, &gerr) || gerr.Header == nil {
+		return 0
+	}
+	secs, perr := strconv.Atoi(gerr.Header.Get("Retry-After"))
+	if perr != nil || secs <= 0 {
+		return 0
+	}
+	return time.Duration(secs) * time.Second
+}
+
+// isRetryable reports whether err is likely transient: server errors, rate
+// limiting and network failures. Authentication and validation errors are
+// not.
+func isRetryable(err error) bool {
+	if errors.Is(err, errSessionExpired) {
+		return false
+	}
+	var gerr *googleapi.Error
+	if errors.As(err, &gerr) {
+		switch {
+		case gerr.Code >= 500, gerr.Code == 429:
+			return true
+		case gerr.Code == 403:
+			for _, e := range gerr.Errors {
+				switch e.Reason {
+				case "rateLimitExceeded", "userRateLimitExceeded", "quotaExceeded", "backendError":
+					return true
+				}
+			}
+		}
+		return false
+	}
+	// *url.Error is itself a net.Error, so look inside it; it also wraps
+	// failures to obtain an access token, which retrying won't fix.
+	var uerr *url.Error
+	if errors.As(err, &uerr) {
+		return isRetryable(uerr.Err)
+	}
+	if errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, io.EOF) {
+		return true
+	}
+	var nerr net.Error
+	return errors.As(err, &nerr)
+}
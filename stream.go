@@ -0,0 +1,229 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"syscall"
+	"time"
+
+	"golang.org/x/crypto/ssh/terminal"
+
+	"google.golang.org/api/youtube/v3"
+)
+
+var (
+	follow     = flag.Bool("follow", false, "Keep uploading -filename as it grows, e.g. while it's being recorded")
+	followIdle = flag.Duration("follow-idle", 30*time.Second, "With -follow, how long the file must stop growing before it's taken as complete")
+)
+
+// FOLLOW_POLL_INTERVAL is how often a followed file is checked for new data.
+const FOLLOW_POLL_INTERVAL = time.Second
+
+// isStream reports whether the video's length is unknown until it has been
+// read to the end: from stdin, or a file being followed.
+func isStream(file string) bool {
+	return file == "-" || *follow
+}
+
+// followReader reads a file that's still being written. At the end of the
+// data it waits for more, and only returns io.EOF once the file has stopped
+// growing for idle.
+type followReader struct {
+	ctx  context.Context
+	file *os.File
+	idle time.Duration
+}
+
+func (r *followReader) Read(p []byte) (int, error) {
+	var waited time.Duration
+	for {
+		n, err := r.file.Read(p)
+		if n > 0 || err != io.EOF {
+			return n, err
+		}
+		if waited >= r.idle {
+			return 0, io.EOF
+		}
+		select {
+		case <-time.After(FOLLOW_POLL_INTERVAL):
+			waited += FOLLOW_POLL_INTERVAL
+		case <-r.ctx.Done():
+			return 0, r.ctx.Err()
+		}
+	}
+}
+
+// progressStream shows how much of a video of unknown length has been sent.
+func progressStream(sent int64, elapsed time.Duration) {
+	rate := 0.0
+	if elapsed > 0 {
+		rate = float64(sent) / (1024 * 1024) / elapsed.Seconds()
+	}
+	msg := fmt.Sprintf("Uploading... (%d KB uploaded, %.1f MB/s)", sent/1024, rate)
+	if terminal.IsTerminal(syscall.Stdout) {
+		fmt.Printf("\x1b[K%s\r", msg)
+	} else {
+		log.Printf("%s\n", msg)
+	}
+}
+
+// queryStreamOffset asks the server how many bytes of a session of unknown
+// length it has committed.
+func queryStreamOffset(ctx context.Context, client *http.Client, sessionURI string) (int64, *youtube.Video, error) {
+	req, err := http.NewRequestWithContext(ctx, "PUT", sessionURI, nil)
+	if err != nil {
+		return 0, nil, err
+	}
+	req.Header.Set("Content-Range", "bytes */*")
+	res, err := client.Do(req)
+	if err != nil {
+		return 0, nil, err
+	}
+	defer res.Body.Close()
+	return handleUploadResponse(res)
+}
+
+// sendStreamChunk sends data at offset. total is the length of the video
+// if data is the end of it, or -1 if more follows.
+func sendStreamChunk(ctx context.Context, client *http.Client, sessionURI string, offset int64, data []byte, total int64) (int64, *youtube.Video, error) {
+	req, err := http.NewRequestWithContext(ctx, "PUT", sessionURI, bytes.NewReader(data))
+	if err != nil {
+		return 0, nil, err
+	}
+	size := "*"
+	if total >= 0 {
+		size = fmt.Sprint(total)
+	}
+	if len(data) == 0 {
+		req.Header.Set("Content-Range", "bytes */"+size)
+	} else {
+		req.Header.Set("Content-Range", fmt.Sprintf("bytes %d-%d/%s", offset, offset+int64(len(data))-1, size))
+	}
+	req.Header.Set("Content-Type", UPLOAD_CONTENT_TYPE)
+
+	res, err := client.Do(req)
+	if err != nil {
+		return 0, nil, err
+	}
+	defer res.Body.Close()
+	return handleUploadResponse(res)
+}
+
+// uploadStreamMedia sends r to the session in CHUNK_SIZE chunks, telling
+// the server the total length with the last one. Each chunk is kept until
+// the server confirms it, so failed ones can be retried.
+func uploadStreamMedia(ctx context.Context, client *http.Client, retry *retryPolicy, sessionURI string, r io.Reader) (*youtube.Video, int64, error) {
+	br := bufio.NewReader(r)
+	buf := make([]byte, CHUNK_SIZE)
+	var offset int64 // Bytes confirmed by the server.
+	start := time.Now()
+	for {
+		n, err := io.ReadFull(br, buf)
+		final := false
+		switch err {
+		case nil:
+			// A full chunk; it's the last one if nothing follows.
+			if _, err := br.Peek(1); err == io.EOF {
+				final = true
+			} else if err != nil {
+				return nil, offset, err
+			}
+		case io.EOF, io.ErrUnexpectedEOF:
+			final = true
+		default:
+			return nil, offset, err
+		}
+		if final && offset+int64(n) == 0 {
+			return nil, 0, fmt.Errorf("No video data to upload")
+		}
+
+		chunkStart, chunkEnd := offset, offset+int64(n)
+		total := int64(-1)
+		if final {
+			total = chunkEnd
+		}
+		for {
+			var video *youtube.Video
+			attempt := 0
+			err := retry.do(ctx, "Uploading", func() error {
+				attempt++
+				if attempt > 1 {
+					committed, v, err := queryStreamOffset(ctx, client, sessionURI)
+					if err != nil {
+						return err
+					}
+					if v != nil {
+						video = v
+						return nil
+					}
+					if committed < chunkStart || committed > chunkEnd {
+						return fmt.Errorf("Server has %d bytes, but only bytes %d-%d can be sent again", committed, chunkStart, chunkEnd)
+					}
+					offset = committed
+				}
+				committed, v, err := sendStreamChunk(ctx, client, sessionURI, offset, buf[offset-chunkStart:n], total)
+				if err != nil {
+					return err
+				}
+				offset, video = committed, v
+				return nil
+			})
+			if err != nil {
+				return nil, offset, err
+			}
+			if video != nil {
+				progressStream(chunkEnd, time.Since(start))
+				return video, chunkEnd, nil
+			}
+			progressStream(offset, time.Since(start))
+			if offset >= chunkEnd && !final {
+				break
+			}
+			if offset < chunkStart || offset > chunkEnd {
+				return nil, offset, fmt.Errorf("Server has %d bytes after bytes %d-%d were sent", offset, chunkStart, chunkEnd)
+			}
+		}
+	}
+}
+
+// uploadStream uploads a video from stdin, or from a file that's being
+// written with -follow. Such uploads can't be resumed by a later process.
+func (u *uploader) uploadStream(ctx context.Context, entry *manifestEntry, upload *youtube.Video) (*youtube.Video, int64, error) {
+	var r io.Reader = os.Stdin
+	if entry.File != "-" {
+		file, err := os.Open(entry.File)
+		if err != nil {
+			return nil, 0, fmt.Errorf("Error opening %v: %v", entry.File, err)
+		}
+		defer file.Close()
+		r = &followReader{ctx: ctx, file: file, idle: *followIdle}
+	}
+
+	var sessionURI string
+	err := u.retry.do(ctx, "Starting upload session", func() (err error) {
+		sessionURI, err = startUploadSession(ctx, u.client, upload, -1)
+		return err
+	})
+	if err != nil {
+		return nil, 0, fmt.Errorf("Error starting upload session: %v", err)
+	}
+
+	response, sent, err := uploadStreamMedia(ctx, u.client, u.retry, sessionURI, r)
+	if err != nil && ctx.Err() != nil {
+		if terminal.IsTerminal(syscall.Stdout) {
+			fmt.Printf("\n")
+		}
+		return nil, 0, fmt.Errorf("Interrupted after %d KB of %s; uploads of streams can't be resumed", sent/1024, entry.File)
+	}
+	if err != nil {
+		return nil, 0, fmt.Errorf("Error uploading video: %v", err)
+	}
+	return response, sent, nil
+}
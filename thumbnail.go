@@ -0,0 +1,74 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"image"
+	_ "image/jpeg"
+	_ "image/png"
+	"math"
+	"os"
+
+	"google.golang.org/api/googleapi"
+	"google.golang.org/api/youtube/v3"
+)
+
+const (
+	THUMBNAIL_MAX_BYTES = 2 * 1024 * 1024
+	THUMBNAIL_MIN_WIDTH = 640
+
+	// Thumbnails should be 16:9; allow for rounding, e.g. 1366x768.
+	THUMBNAIL_ASPECT_RATIO = 16.0 / 9.0
+	THUMBNAIL_ASPECT_SLACK = 0.01
+)
+
+// validateThumbnail checks a thumbnail against YouTube's requirements, so a
+// bad one is reported before spending time uploading the video.
+// It returns the MIME type of the image.
+func validateThumbnail(path string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	fi, err := file.Stat()
+	if err != nil {
+		return "", err
+	}
+	if fi.Size() > THUMBNAIL_MAX_BYTES {
+		return "", fmt.Errorf("Thumbnail %s is %d KB; it must be 2 MB or smaller", path, fi.Size()/1024)
+	}
+
+	config, format, err := image.DecodeConfig(file)
+	if err != nil {
+		return "", fmt.Errorf("Thumbnail %s is not a JPEG or PNG image: %v", path, err)
+	}
+	if config.Width < THUMBNAIL_MIN_WIDTH {
+		return "", fmt.Errorf("Thumbnail %s is %d pixels wide; it must be at least %d", path, config.Width, THUMBNAIL_MIN_WIDTH)
+	}
+	ratio := float64(config.Width) / float64(config.Height)
+	if math.Abs(ratio-THUMBNAIL_ASPECT_RATIO)/THUMBNAIL_ASPECT_RATIO > THUMBNAIL_ASPECT_SLACK {
+		return "", fmt.Errorf("Thumbnail %s is %dx%d; it must have a 16:9 aspect ratio", path, config.Width, config.Height)
+	}
+	return "image/" + format, nil
+}
+
+func setThumbnail(ctx context.Context, service *youtube.Service, videoId string, path string) error {
+	mimeType, err := validateThumbnail(path)
+	if err != nil {
+		return err
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	thumbnails := youtube.NewThumbnailsService(service)
+	_, err = thumbnails.Set(videoId).Media(file, googleapi.ContentType(mimeType)).Context(ctx).Do()
+	if err != nil {
+		return fmt.Errorf("Error setting thumbnail: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,196 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+	"syscall"
+
+	"golang.org/x/crypto/ssh/terminal"
+	"golang.org/x/oauth2"
+
+	"github.com/omakoto/yt-up/oauth"
+)
+
+const (
+	KEYRING_SERVICE = "yt-up"
+	PASSPHRASE_ENV  = "YT_UP_TOKEN_PASSPHRASE"
+)
+
+var tokenStore = flag.String("token-store", "file", "Where to keep OAuth tokens: file (plain text), keyring, encrypted (passphrase protected file), or auto (keyring if available, else file)")
+
+func checkTokenStore() error {
+	switch *tokenStore {
+	case "file", "keyring", "encrypted", "auto":
+		return nil
+	}
+	return fmt.Errorf("-token-store must be file, keyring, encrypted or auto")
+}
+
+var (
+	passphraseOnce sync.Once
+	passphrase     []byte
+	passphraseErr  error
+)
+
+// readPassphrase returns the passphrase for the encrypted token cache from
+// the environment, or asks for it once.
+func readPassphrase() ([]byte, error) {
+	passphraseOnce.Do(func() {
+		if p := os.Getenv(PASSPHRASE_ENV); p != "" {
+			passphrase = []byte(p)
+			return
+		}
+		if !terminal.IsTerminal(syscall.Stdin) {
+			passphraseErr = fmt.Errorf("Set %s to decrypt the token cache", PASSPHRASE_ENV)
+			return
+		}
+		fmt.Fprint(os.Stderr, "Token cache passphrase: ")
+		passphrase, passphraseErr = terminal.ReadPassword(syscall.Stdin)
+		fmt.Fprintln(os.Stderr)
+		if passphraseErr == nil && len(passphrase) == 0 {
+			passphraseErr = fmt.Errorf("Empty passphrase")
+		}
+	})
+	return passphrase, passphraseErr
+}
+
+// tokenCache returns the cache for the account's token in the store
+// selected with -token-store.
+func tokenCache() oauth.Cache {
+	return tokenCacheIn(*tokenStore, *account)
+}
+
+func tokenCacheIn(store string, name string) oauth.Cache {
+	return cacheIn(store, tokenCacheFile(name), accountLabel(name))
+}
+
+// serviceAccountCache returns the cache for a service account's token,
+// which is kept apart from the accounts' tokens.
+func serviceAccountCache(email string, subject string) oauth.Cache {
+	id := email
+	if subject != "" {
+		id += "." + subject
+	}
+	return cacheIn(*tokenStore, getHomeDir()+"/.yt-up.service."+id+".cache", "service:"+id)
+}
+
+// cacheIn returns the cache in store, where path is the file for the file
+// based stores and user the keyring entry.
+func cacheIn(store string, path string, user string) oauth.Cache {
+	switch store {
+	case "keyring":
+		return oauth.KeyringCache{Service: KEYRING_SERVICE, User: user}
+	case "encrypted":
+		return oauth.EncryptedCacheFile{Path: path + ".enc", Passphrase: readPassphrase}
+	case "auto":
+		if oauth.KeyringAvailable() {
+			return cacheIn("keyring", path, user)
+		}
+	}
+	return oauth.CacheFile(path)
+}
+
+// accountCaches returns every store the account's token may be in.
+func accountCaches(name string) []oauth.Cache {
+	caches := []oauth.Cache{tokenCacheIn("file", name), tokenCacheIn("encrypted", name)}
+	if oauth.KeyringAvailable() {
+		caches = append(caches, tokenCacheIn("keyring", name))
+	}
+	return caches
+}
+
+// deleteTokens deletes the account's token from every store.
+func deleteTokens(name string) error {
+	for _, cache := range accountCaches(name) {
+		if err := cache.Delete(); err != nil {
+			return fmt.Errorf("Error deleting token: %v", err)
+		}
+	}
+	return nil
+}
+
+// logout revokes the account's token at Google and deletes it. If Google
+// can't be reached, the token is kept so logout can be tried again, unless
+// force is set.
+func logout(ctx context.Context, name string, force bool) error {
+	var tok *oauth2.Token
+	for _, cache := range accountCaches(name) {
+		if t, err := cache.Token(); err == nil {
+			tok = t
+			break
+		}
+	}
+	if tok == nil {
+		return fmt.Errorf("Account %s is not logged in", accountLabel(name))
+	}
+
+	revokeErr := oauth.Revoke(ctx, REVOKE_URL, tok)
+	// Google rejecting the token, e.g. with invalid_token, means it's no
+	// good anyway; after a network or server error it may still be, and
+	// this is the only copy.
+	var oerr *oauth.Error
+	rejected := errors.As(revokeErr, &oerr) && oerr.Status >= 400 && oerr.Status < 500
+	if revokeErr != nil && !rejected && !force {
+		return fmt.Errorf("Could not revoke the token for account %s at Google, so it's kept; run logout again, or use logout -force to delete it anyway: %v", accountLabel(name), revokeErr)
+	}
+	if err := deleteTokens(name); err != nil {
+		return err
+	}
+	saveChannelTitle(name, "")
+	if revokeErr != nil {
+		return fmt.Errorf("Deleted the local token for account %s, but could not revoke it at Google: %v", accountLabel(name), revokeErr)
+	}
+	log.Printf("Revoked the token for account %s at Google and deleted it locally\n", accountLabel(name))
+	return nil
+}
+
+func logoutCommand(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("logout", flag.ContinueOnError)
+	force := fs.Bool("force", false, "Delete the local token even if it can't be revoked at Google")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 0 {
+		return fmt.Errorf("Usage: yt-up [-account NAME] logout [-force]")
+	}
+	return logout(ctx, *account, *force)
+}
+
+// migrateToken moves the account's token from the plain text cache file to
+// the store selected with -token-store.
+func migrateToken() error {
+	if *tokenStore == "file" || (*tokenStore == "auto" && !oauth.KeyringAvailable()) {
+		return fmt.Errorf("Select where to migrate to with -token-store keyring or encrypted")
+	}
+	plain := tokenCacheFile(*account)
+	tok, err := oauth.CacheFile(plain).Token()
+	if err != nil {
+		return fmt.Errorf("Error reading %s: %v", plain, err)
+	}
+	if err := tokenCache().PutToken(tok); err != nil {
+		return fmt.Errorf("Error storing token: %v", err)
+	}
+	if err := os.Remove(plain); err != nil {
+		return err
+	}
+	log.Printf("Moved the token for account %s from %s to the %s store\n", accountLabel(*account), plain, *tokenStore)
+	return nil
+}
+
+func authCommand(ctx context.Context, args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("Usage: yt-up auth migrate|status")
+	}
+	switch args[0] {
+	case "migrate":
+		return migrateToken()
+	case "status":
+		return authStatusCommand(ctx, args[1:])
+	}
+	return fmt.Errorf("Unknown auth command %q", args[0])
+}
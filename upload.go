@@ -0,0 +1,358 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/omakoto/yt-up/oauth"
+	"google.golang.org/api/googleapi"
+	"google.golang.org/api/youtube/v3"
+)
+
+const (
+	UPLOAD_URL = "https://www.googleapis.com/upload/youtube/v3/videos"
+
+	// CHUNK_SIZE is the size of each PUT request body. The resumable
+	// upload protocol requires it to be a multiple of 256 KB.
+	CHUNK_SIZE = 8 * 1024 * 1024
+
+	UPLOAD_CONTENT_TYPE = "video/*"
+)
+
+// uploadState is what's persisted in the state file so an interrupted
+// upload can be continued by a later process.
+type uploadState struct {
+	SessionURI string
+	Filename   string // Absolute path.
+	Size       int64
+	ModTime    time.Time
+	Offset     int64 // Bytes confirmed by the server.
+
+	// VideoId is set once the media is uploaded, and Finished once the
+	// thumbnail, playlist and captions are set too. A manifest run with
+	// -resume skips finished files and finishes the others.
+	VideoId  string `json:",omitempty"`
+	Finished bool   `json:",omitempty"`
+}
+
+// uploadStateFile holds the state of each interrupted upload, keyed by the
+// absolute path of the file.
+func uploadStateFile() string {
+	return getHomeDir() + "/.yt-up.resume"
+}
+
+func absPath(filename string) string {
+	if abs, err := filepath.Abs(filename); err == nil {
+		return abs
+	}
+	return filename
+}
+
+// loadUploadStates returns all saved states. A state file from before
+// states were kept per file holds a single one.
+func loadUploadStates() (map[string]*uploadState, error) {
+	states := make(map[string]*uploadState)
+	data, err := ioutil.ReadFile(uploadStateFile())
+	if os.IsNotExist(err) {
+		return states, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var raw map[string]json.RawMessage
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, fmt.Errorf("Broken state file %s: %v", uploadStateFile(), err)
+	}
+	if _, ok := raw["SessionURI"]; ok {
+		raw = map[string]json.RawMessage{"": data}
+	}
+	for _, v := range raw {
+		state := &uploadState{}
+		if err := json.Unmarshal(v, state); err != nil {
+			return nil, fmt.Errorf("Broken state file %s: %v", uploadStateFile(), err)
+		}
+		state.Filename = absPath(state.Filename)
+		states[state.Filename] = state
+	}
+	return states, nil
+}
+
+func writeUploadStates(states map[string]*uploadState) error {
+	if len(states) == 0 {
+		if err := os.Remove(uploadStateFile()); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return nil
+	}
+	data, err := json.Marshal(states)
+	if err != nil {
+		return err
+	}
+	return oauth.WriteFileAtomic(uploadStateFile(), data)
+}
+
+// updateUploadStates lets update change the saved states. Other processes
+// may be uploading too, so the file is locked while it's read and
+// rewritten.
+func updateUploadStates(update func(states map[string]*uploadState)) error {
+	unlock, err := oauth.LockFile(uploadStateFile() + ".lock")
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	states, err := loadUploadStates()
+	if err != nil {
+		return err
+	}
+	update(states)
+	return writeUploadStates(states)
+}
+
+// loadUploadState returns the saved state of the file, or nil if there's
+// none.
+func loadUploadState(filename string) (*uploadState, error) {
+	states, err := loadUploadStates()
+	if err != nil {
+		return nil, err
+	}
+	return states[absPath(filename)], nil
+}
+
+func saveUploadState(state *uploadState) error {
+	return updateUploadStates(func(states map[string]*uploadState) {
+		states[state.Filename] = state
+	})
+}
+
+func removeUploadState(filename string) {
+	err := updateUploadStates(func(states map[string]*uploadState) {
+		delete(states, absPath(filename))
+	})
+	if err != nil {
+		log.Printf("Error removing upload state: %v", err)
+	}
+}
+
+// markUploadFinished records that nothing is left to do for the file.
+func markUploadFinished(filename string) {
+	err := updateUploadStates(func(states map[string]*uploadState) {
+		if state := states[absPath(filename)]; state != nil {
+			state.Finished = true
+		}
+	})
+	if err != nil {
+		log.Printf("Error saving state file: %v", err)
+	}
+}
+
+// resumableState returns the interrupted upload of filename, or the only
+// interrupted upload if filename is empty.
+func resumableState(filename string) (*uploadState, error) {
+	states, err := loadUploadStates()
+	if err != nil {
+		return nil, fmt.Errorf("Error reading upload state: %v", err)
+	}
+	if filename != "" {
+		state := states[absPath(filename)]
+		if state == nil || state.VideoId != "" {
+			return nil, fmt.Errorf("No interrupted upload of %s to resume", filename)
+		}
+		return state, nil
+	}
+	var pending []string
+	for name, state := range states {
+		if state.VideoId == "" {
+			pending = append(pending, name)
+		}
+	}
+	sort.Strings(pending)
+	switch len(pending) {
+	case 0:
+		return nil, fmt.Errorf("No interrupted upload to resume")
+	case 1:
+		return states[pending[0]], nil
+	}
+	return nil, fmt.Errorf("Several interrupted uploads; pick one with -filename: %s", strings.Join(pending, ", "))
+}
+
+// matches reports whether the state refers to the given file, unmodified.
+func (state *uploadState) matches(fi os.FileInfo) bool {
+	return state.Size == fi.Size() && state.ModTime.Equal(fi.ModTime())
+}
+
+// startUploadSession sends the video metadata and returns the session URI
+// to which the media should be sent. A negative size means it's unknown.
+func startUploadSession(ctx context.Context, client *http.Client, video *youtube.Video, size int64) (string, error) {
+	body, err := json.Marshal(video)
+	if err != nil {
+		return "", err
+	}
+	req, err := http.NewRequestWithContext(ctx, "POST", UPLOAD_URL+"?uploadType=resumable&part=snippet,status", bytes.NewReader(body))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/json; charset=UTF-8")
+	if size >= 0 {
+		req.Header.Set("X-Upload-Content-Length", strconv.FormatInt(size, 10))
+	}
+	req.Header.Set("X-Upload-Content-Type", UPLOAD_CONTENT_TYPE)
+
+	res, err := client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return "", responseError(res)
+	}
+	location := res.Header.Get("Location")
+	if location == "" {
+		return "", fmt.Errorf("No session URI returned for upload")
+	}
+	return location, nil
+}
+
+var errSessionExpired = errors.New("Upload session has expired; start the upload over without -resume")
+
+var rangeRe = regexp.MustCompile(`^bytes=0-(\d+)$`)
+
+// handleUploadResponse interprets a response from the session URI.
+// It returns the number of bytes the server has, or the inserted video
+// when the upload is complete.
+func handleUploadResponse(res *http.Response) (int64, *youtube.Video, error) {
+	switch res.StatusCode {
+	case http.StatusOK, http.StatusCreated:
+		video := &youtube.Video{}
+		if err := json.NewDecoder(res.Body).Decode(video); err != nil {
+			return 0, nil, err
+		}
+		return 0, video, nil
+	case http.StatusPermanentRedirect:
+		r := res.Header.Get("Range")
+		if r == "" {
+			return 0, nil, nil
+		}
+		m := rangeRe.FindStringSubmatch(r)
+		if m == nil {
+			return 0, nil, fmt.Errorf("Unexpected Range header: %s", r)
+		}
+		last, err := strconv.ParseInt(m[1], 10, 64)
+		if err != nil {
+			return 0, nil, err
+		}
+		return last + 1, nil, nil
+	case http.StatusNotFound, http.StatusGone:
+		return 0, nil, errSessionExpired
+	}
+	return 0, nil, responseError(res)
+}
+
+// queryUploadOffset asks the server how many bytes of the session it has
+// committed.
+func queryUploadOffset(ctx context.Context, client *http.Client, state *uploadState) (int64, *youtube.Video, error) {
+	req, err := http.NewRequestWithContext(ctx, "PUT", state.SessionURI, nil)
+	if err != nil {
+		return 0, nil, err
+	}
+	req.Header.Set("Content-Range", fmt.Sprintf("bytes */%d", state.Size))
+	res, err := client.Do(req)
+	if err != nil {
+		return 0, nil, err
+	}
+	defer res.Body.Close()
+	return handleUploadResponse(res)
+}
+
+// uploadMedia sends the file from state.Offset on, saving the state after
+// each chunk the server confirms. A failed chunk is retried per retry, after
+// asking the server how much it actually got. Cancelling ctx stops it with
+// the state saved up to the last confirmed chunk.
+func uploadMedia(ctx context.Context, client *http.Client, retry *retryPolicy, state *uploadState, file io.ReaderAt) (*youtube.Video, error) {
+	for {
+		progress(state.Offset, state.Size)
+
+		var video *youtube.Video
+		attempt := 0
+		err := retry.do(ctx, "Uploading", func() error {
+			attempt++
+			if attempt > 1 {
+				offset, v, err := queryUploadOffset(ctx, client, state)
+				if err != nil {
+					return err
+				}
+				if v != nil {
+					video = v
+					return nil
+				}
+				state.Offset = offset
+			}
+			offset, v, err := sendChunk(ctx, client, state, file)
+			if err != nil {
+				return err
+			}
+			state.Offset, video = offset, v
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+		if video != nil {
+			progress(state.Size, state.Size)
+			return video, nil
+		}
+		if err := saveUploadState(state); err != nil {
+			log.Printf("Error saving state file: %v", err)
+		}
+	}
+}
+
+// sendChunk sends up to CHUNK_SIZE bytes from state.Offset.
+func sendChunk(ctx context.Context, client *http.Client, state *uploadState, file io.ReaderAt) (int64, *youtube.Video, error) {
+	n := state.Size - state.Offset
+	if n > CHUNK_SIZE {
+		n = CHUNK_SIZE
+	}
+	req, err := http.NewRequestWithContext(ctx, "PUT", state.SessionURI, io.NewSectionReader(file, state.Offset, n))
+	if err != nil {
+		return 0, nil, err
+	}
+	req.ContentLength = n
+	// Let the chunk be sent again if the access token is rejected.
+	offset := state.Offset
+	req.GetBody = func() (io.ReadCloser, error) {
+		return ioutil.NopCloser(io.NewSectionReader(file, offset, n)), nil
+	}
+	req.Header.Set("Content-Type", UPLOAD_CONTENT_TYPE)
+	req.Header.Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", state.Offset, state.Offset+n-1, state.Size))
+
+	res, err := client.Do(req)
+	if err != nil {
+		return 0, nil, err
+	}
+	defer res.Body.Close()
+	return handleUploadResponse(res)
+}
+
+// responseError builds an error from an unexpected API response.
+// Error statuses are returned as *googleapi.Error.
+func responseError(res *http.Response) error {
+	if err := googleapi.CheckResponse(res); err != nil {
+		return err
+	}
+	body, _ := ioutil.ReadAll(io.LimitReader(res.Body, 1<<16))
+	return fmt.Errorf("Unexpected HTTP status %s: %s", res.Status, bytes.TrimSpace(body))
+}